@@ -1,18 +1,22 @@
-package main
-
-import (
-	"crypto/sha256"
-	"fmt"
-)
-
-func main() {
-	passwords := map[string]string{
-		"admin123":   "admin",
-		"petugas123": "petugas",
-	}
-
-	for pass, user := range passwords {
-		hash := sha256.Sum256([]byte(pass))
-		fmt.Printf("User: %s | Password: %s | Hash: %x\n", user, pass, hash)
-	}
-}
+package main
+
+import (
+	"fmt"
+	"jimpitan/backend/internal/utils"
+	"log"
+)
+
+func main() {
+	passwords := map[string]string{
+		"admin123":   "admin",
+		"petugas123": "petugas",
+	}
+
+	for pass, user := range passwords {
+		hash, err := utils.HashPassword(pass)
+		if err != nil {
+			log.Fatalf("Failed to hash password for %s: %v", user, err)
+		}
+		fmt.Printf("User: %s | Password: %s | Hash: %s\n", user, pass, hash)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/services"
+	"os"
+)
+
+// runLedger implements `backend-go-server ledger verify|head|backfill`.
+// verify exits 0 when the hash chain is intact, 2 when it is broken and 1
+// on errors, so it can be used from cron.
+func runLedger(db *database.DB, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: ledger verify | ledger head [-month YYYY-MM] | ledger backfill")
+		return 1
+	}
+
+	service := services.NewLedgerChainService(db)
+
+	switch args[0] {
+	case "verify":
+		report, err := service.Verify()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ledger verify: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%d entries checked, head #%d %s\n", report.Checked, report.HeadSeq, report.HeadHash)
+		if report.Broken != nil {
+			fmt.Printf("BROKEN at #%d %s %s: %s\n", report.Broken.Seq, report.Broken.Kind, report.Broken.ID, report.Broken.Reason)
+			return 2
+		}
+		fmt.Println("chain OK")
+		return 0
+
+	case "head":
+		fs := flag.NewFlagSet("ledger head", flag.ContinueOnError)
+		month := fs.String("month", "", "month to export (YYYY-MM); default: current head")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 1
+		}
+		head, err := service.MonthHead(*month)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ledger head: %v\n", err)
+			return 1
+		}
+		fmt.Printf("until:        %s\n", head.Until.Format("2006-01-02 15:04:05"))
+		fmt.Printf("seq:          %d\n", head.Seq)
+		fmt.Printf("hash:         %s\n", head.Hash)
+		fmt.Printf("transactions: %d\n", head.Transactions)
+		fmt.Printf("total:        %s\n", head.Total)
+		return 0
+
+	case "backfill":
+		chained, err := service.Backfill()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ledger backfill: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%d entries chained\n", chained)
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "ledger: unknown command %q\n", args[0])
+	return 1
+}
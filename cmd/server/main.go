@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"jimpitan/backend/internal/auth"
 	"jimpitan/backend/internal/config"
 	"jimpitan/backend/internal/database"
 	"jimpitan/backend/internal/handlers"
@@ -10,6 +11,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -26,17 +28,66 @@ func main() {
 	}
 	defer db.Close()
 
+	// `reconcile [-fix]` checks customer balances and exits instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		code := runReconcile(db, os.Args[2:])
+		db.Close()
+		os.Exit(code)
+	}
+
+	// `ledger verify|head|backfill` works on the ledger hash chain and exits
+	if len(os.Args) > 1 && os.Args[1] == "ledger" {
+		code := runLedger(db, os.Args[2:])
+		db.Close()
+		os.Exit(code)
+	}
+
 	// Initialize services
-	authService := services.NewAuthService(db, cfg.JWT.Secret, cfg.JWT.ExpiryHours)
-	userService := services.NewUserService(db)
-	customerService := services.NewCustomerService(db)
-	transactionService := services.NewTransactionService(db)
+	sessionService := services.NewSessionService(db)
+	securityEventService := services.NewSecurityEventService(db)
+	auditService := services.NewAuditService(db)
+	loginThrottleService := services.NewLoginThrottleService(db, securityEventService)
+	configService := services.NewConfigService(db, auditService)
+	twoFactorService := services.NewTwoFactorService(db, &cfg.TwoFactor, auditService)
+	authService := services.NewAuthService(db, sessionService, loginThrottleService, twoFactorService, configService, auditService, &cfg.JWT)
+	passwordResetService := services.NewPasswordResetService(db, sessionService, loginThrottleService, securityEventService, auditService)
+	approvalService := services.NewApprovalService(db, configService, auditService)
+	configService.RegisterApprovals(approvalService)
+	userService := services.NewUserService(db, sessionService, loginThrottleService, auditService, approvalService)
+	customerService := services.NewCustomerService(db, auditService)
+	idempotencyService := services.NewIdempotencyService(db)
+	transactionService := services.NewTransactionService(db, idempotencyService, securityEventService, auditService, approvalService)
+	reportService := services.NewReportService(db)
+	reconciliationService := services.NewReconciliationService(db, securityEventService)
+	ledgerChainService := services.NewLedgerChainService(db)
+	periodService := services.NewPeriodService(db, ledgerChainService, auditService, approvalService)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService)
+	passwordResetHandler := handlers.NewPasswordResetHandler(passwordResetService)
 	userHandler := handlers.NewUserHandler(userService)
 	customerHandler := handlers.NewCustomerHandler(customerService)
 	transactionHandler := handlers.NewTransactionHandler(transactionService)
+	reportHandler := handlers.NewReportHandler(reportService)
+	configHandler := handlers.NewConfigHandler(configService)
+	syncHandler := handlers.NewSyncHandler(transactionService, customerService)
+	reconciliationHandler := handlers.NewReconciliationHandler(reconciliationService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	ledgerHandler := handlers.NewLedgerHandler(ledgerChainService)
+	approvalHandler := handlers.NewApprovalHandler(approvalService)
+	periodHandler := handlers.NewPeriodHandler(periodService)
+
+	// Initialize middleware
+	requireAuth := middleware.AuthMiddleware(&cfg.JWT, sessionService, configService)
+
+	// allow declares the route policy: the handler runs only for users holding
+	// at least one of perms. Routes without a policy are open to any
+	// authenticated user.
+	allow := func(h http.HandlerFunc, perms ...auth.Permission) http.Handler {
+		return middleware.RequirePermission(perms...)(h)
+	}
 
 	// Setup routes
 	router := mux.NewRouter()
@@ -47,49 +98,143 @@ func main() {
 
 	// Auth endpoints
 	router.HandleFunc("/api/login", authHandler.Login).Methods(http.MethodPost)
+	router.HandleFunc("/api/login/2fa", authHandler.LoginTwoFactor).Methods(http.MethodPost)
+	router.HandleFunc("/api/login/2fa/setup", authHandler.LoginTwoFactorSetup).Methods(http.MethodPost)
+	router.HandleFunc("/api/password/reset", passwordResetHandler.Redeem).Methods(http.MethodPost)
+	router.HandleFunc("/api/token/refresh", authHandler.RefreshToken).Methods(http.MethodPost)
 	router.HandleFunc("/api/verifyToken", authHandler.VerifyToken).Methods(http.MethodGet)
-	router.HandleFunc("/api/logout", authHandler.Logout).Methods(http.MethodPost)
+	router.Handle("/api/logout", requireAuth(http.HandlerFunc(authHandler.Logout))).Methods(http.MethodPost)
+
+	// Session endpoints (protected)
+	sessionRoutes := router.PathPrefix("/api/sessions").Subrouter()
+	sessionRoutes.Use(requireAuth)
+	sessionRoutes.HandleFunc("", sessionHandler.GetMySessions).Methods(http.MethodGet)
+	sessionRoutes.HandleFunc("", sessionHandler.RevokeMySession).Methods(http.MethodDelete)
+	sessionRoutes.HandleFunc("/revoke-all", sessionHandler.RevokeAllMySessions).Methods(http.MethodPost)
+
+	// Two-factor endpoints (protected)
+	twoFactorRoutes := router.PathPrefix("/api/2fa").Subrouter()
+	twoFactorRoutes.Use(requireAuth)
+	twoFactorRoutes.HandleFunc("/setup", twoFactorHandler.Setup).Methods(http.MethodPost)
+	twoFactorRoutes.HandleFunc("/enable", twoFactorHandler.Enable).Methods(http.MethodPost)
+	twoFactorRoutes.HandleFunc("/disable", twoFactorHandler.Disable).Methods(http.MethodPost)
+	twoFactorRoutes.HandleFunc("/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes).Methods(http.MethodPost)
 
 	// User endpoints (protected)
 	userRoutes := router.PathPrefix("/api/users").Subrouter()
-	userRoutes.Use(middleware.AuthMiddleware(&cfg.JWT))
-	userRoutes.HandleFunc("", userHandler.GetUsers).Methods(http.MethodGet)
-	userRoutes.HandleFunc("", userHandler.CreateUser).Methods(http.MethodPost)
-	userRoutes.HandleFunc("", userHandler.UpdateUser).Methods(http.MethodPut)
-	userRoutes.HandleFunc("", userHandler.DeleteUser).Methods(http.MethodDelete)
-	userRoutes.HandleFunc("/activity", userHandler.GetUserActivity).Methods(http.MethodGet)
-	userRoutes.HandleFunc("/bulk-delete", userHandler.BulkDeleteUsers).Methods(http.MethodPost)
+	userRoutes.Use(requireAuth)
+	userRoutes.Handle("", allow(userHandler.GetUsers, auth.PermUsersRead)).Methods(http.MethodGet)
+	userRoutes.Handle("", allow(userHandler.CreateUser, auth.PermUsersWrite)).Methods(http.MethodPost)
+	userRoutes.Handle("", allow(userHandler.UpdateUser, auth.PermUsersWrite)).Methods(http.MethodPut)
+	userRoutes.Handle("", allow(userHandler.DeleteUser, auth.PermUsersWrite)).Methods(http.MethodDelete)
+	userRoutes.Handle("/activity", allow(userHandler.GetUserActivity, auth.PermUsersRead)).Methods(http.MethodGet)
+	userRoutes.Handle("/bulk-delete", allow(userHandler.BulkDeleteUsers, auth.PermUsersWrite)).Methods(http.MethodPost)
+	userRoutes.Handle("/trash", allow(userHandler.GetTrash, auth.PermUsersWrite)).Methods(http.MethodGet)
+	userRoutes.Handle("/restore", allow(userHandler.Restore, auth.PermUsersWrite)).Methods(http.MethodPost)
 	userRoutes.HandleFunc("/password", userHandler.UpdatePassword).Methods(http.MethodPost)
+	userRoutes.Handle("/unlock", allow(userHandler.UnlockUser, auth.PermUsersWrite)).Methods(http.MethodPost)
+	userRoutes.Handle("/reset-code", allow(passwordResetHandler.IssueCode, auth.PermUsersWrite)).Methods(http.MethodPost)
+	userRoutes.Handle("/sessions", allow(sessionHandler.GetUserSessions, auth.PermUsersRead)).Methods(http.MethodGet)
+	userRoutes.Handle("/sessions", allow(sessionHandler.RevokeUserSessions, auth.PermUsersWrite)).Methods(http.MethodDelete)
 
 	// Customer endpoints (protected)
 	customerRoutes := router.PathPrefix("/api/customers").Subrouter()
-	customerRoutes.Use(middleware.AuthMiddleware(&cfg.JWT))
-	customerRoutes.HandleFunc("", customerHandler.GetCustomers).Methods(http.MethodGet)
-	customerRoutes.HandleFunc("", customerHandler.CreateCustomer).Methods(http.MethodPost)
-	customerRoutes.HandleFunc("", customerHandler.UpdateCustomer).Methods(http.MethodPut)
-	customerRoutes.HandleFunc("", customerHandler.DeleteCustomer).Methods(http.MethodDelete)
-	customerRoutes.HandleFunc("/qr", customerHandler.GetCustomerByQRHash).Methods(http.MethodGet)
-	customerRoutes.HandleFunc("/history", customerHandler.GetCustomerHistory).Methods(http.MethodGet)
-	customerRoutes.HandleFunc("/bulk-delete", customerHandler.BulkDeleteCustomers).Methods(http.MethodPost)
+	customerRoutes.Use(requireAuth)
+	customerRoutes.Handle("", allow(customerHandler.GetCustomers, auth.PermCustomersRead)).Methods(http.MethodGet)
+	customerRoutes.Handle("", allow(customerHandler.CreateCustomer, auth.PermCustomersWrite)).Methods(http.MethodPost)
+	customerRoutes.Handle("", allow(customerHandler.UpdateCustomer, auth.PermCustomersWrite)).Methods(http.MethodPut)
+	customerRoutes.Handle("", allow(customerHandler.DeleteCustomer, auth.PermCustomersWrite)).Methods(http.MethodDelete)
+	customerRoutes.Handle("/qr", allow(customerHandler.GetCustomerByQRHash, auth.PermCustomersRead)).Methods(http.MethodGet)
+	customerRoutes.Handle("/history", allow(customerHandler.GetCustomerHistory, auth.PermCustomersRead)).Methods(http.MethodGet)
+	customerRoutes.Handle("/bulk-delete", allow(customerHandler.BulkDeleteCustomers, auth.PermCustomersWrite)).Methods(http.MethodPost)
+	customerRoutes.Handle("/trash", allow(customerHandler.GetTrash, auth.PermCustomersWrite)).Methods(http.MethodGet)
+	customerRoutes.Handle("/restore", allow(customerHandler.Restore, auth.PermCustomersWrite)).Methods(http.MethodPost)
 
 	// Transaction endpoints (protected)
 	transactionRoutes := router.PathPrefix("/api/transactions").Subrouter()
-	transactionRoutes.Use(middleware.AuthMiddleware(&cfg.JWT))
-	transactionRoutes.HandleFunc("", transactionHandler.GetHistory).Methods(http.MethodGet)
-	transactionRoutes.HandleFunc("/my-history", transactionHandler.GetMyHistory).Methods(http.MethodGet)
-	transactionRoutes.HandleFunc("", transactionHandler.SubmitTransaction).Methods(http.MethodPost)
-	transactionRoutes.HandleFunc("", transactionHandler.DeleteTransaction).Methods(http.MethodDelete)
-	transactionRoutes.HandleFunc("/bulk-delete", transactionHandler.BulkDeleteTransactions).Methods(http.MethodPost)
+	transactionRoutes.Use(requireAuth)
+	transactionRoutes.Handle("", allow(transactionHandler.GetHistory, auth.PermTransactionsRead)).Methods(http.MethodGet)
+	transactionRoutes.Handle("/my-history", allow(transactionHandler.GetMyHistory, auth.PermTransactionsReadOwn, auth.PermTransactionsRead)).Methods(http.MethodGet)
+	transactionRoutes.Handle("", allow(transactionHandler.SubmitTransaction, auth.PermTransactionsCreate)).Methods(http.MethodPost)
+	transactionRoutes.Handle("", allow(transactionHandler.UpdateTransaction, auth.PermTransactionsUpdate)).Methods(http.MethodPut)
+	transactionRoutes.Handle("", allow(transactionHandler.DeleteTransaction, auth.PermTransactionsDeleteOwn, auth.PermTransactionsDeleteAny)).Methods(http.MethodDelete)
+	transactionRoutes.Handle("/revisions", allow(transactionHandler.GetRevisions, auth.PermTransactionsReadOwn, auth.PermTransactionsRead)).Methods(http.MethodGet)
+	transactionRoutes.Handle("/reverse", allow(transactionHandler.ReverseTransaction, auth.PermTransactionsDeleteOwn, auth.PermTransactionsDeleteAny)).Methods(http.MethodPost)
+	transactionRoutes.Handle("/bulk-delete", allow(transactionHandler.BulkDeleteTransactions, auth.PermTransactionsDeleteAny)).Methods(http.MethodPost)
+	transactionRoutes.Handle("/trash", allow(transactionHandler.GetTrash, auth.PermTransactionsDeleteAny)).Methods(http.MethodGet)
+	transactionRoutes.Handle("/restore", allow(transactionHandler.Restore, auth.PermTransactionsDeleteAny)).Methods(http.MethodPost)
+
+	// Offline sync endpoints (protected)
+	syncRoutes := router.PathPrefix("/api/sync").Subrouter()
+	syncRoutes.Use(requireAuth)
+	syncRoutes.Handle("/transactions", allow(syncHandler.SyncTransactions, auth.PermTransactionsCreate)).Methods(http.MethodPost)
+	syncRoutes.Handle("/customers", allow(syncHandler.SyncCustomers, auth.PermCustomersRead)).Methods(http.MethodGet)
+
+	// Report endpoints (protected)
+	reportRoutes := router.PathPrefix("/api/reports").Subrouter()
+	reportRoutes.Use(requireAuth)
+	reportRoutes.Handle("/summary", allow(reportHandler.GetSummary, auth.PermReportsView)).Methods(http.MethodGet)
+
+	// Config endpoints (protected)
+	configRoutes := router.PathPrefix("/api/config").Subrouter()
+	configRoutes.Use(requireAuth)
+	configRoutes.Handle("", allow(configHandler.GetConfig, auth.PermConfigManage)).Methods(http.MethodGet)
+	configRoutes.Handle("", allow(configHandler.UpdateConfig, auth.PermConfigManage)).Methods(http.MethodPut)
+
+	// Reconciliation endpoints (protected)
+	reconciliationRoutes := router.PathPrefix("/api/reconciliation").Subrouter()
+	reconciliationRoutes.Use(requireAuth)
+	reconciliationRoutes.Handle("", allow(reconciliationHandler.Check, auth.PermLedgerReconcile)).Methods(http.MethodGet)
+	reconciliationRoutes.Handle("/repair", allow(reconciliationHandler.Repair, auth.PermLedgerReconcile)).Methods(http.MethodPost)
+
+	// Ledger hash chain endpoints (protected)
+	ledgerRoutes := router.PathPrefix("/api/ledger").Subrouter()
+	ledgerRoutes.Use(requireAuth)
+	ledgerRoutes.Handle("/verify", allow(ledgerHandler.Verify, auth.PermLedgerReconcile)).Methods(http.MethodGet)
+	ledgerRoutes.Handle("/head", allow(ledgerHandler.GetHead, auth.PermReportsView)).Methods(http.MethodGet)
+
+	// Approval endpoints (protected). Anyone who can make a request that needs
+	// approval may list their own requests.
+	approvalRoutes := router.PathPrefix("/api/approvals").Subrouter()
+	approvalRoutes.Use(requireAuth)
+	approvalRoutes.Handle("", allow(approvalHandler.GetApprovals, auth.PermApprovalsDecide, auth.PermUsersWrite, auth.PermTransactionsDeleteOwn, auth.PermTransactionsDeleteAny, auth.PermPeriodsClose, auth.PermConfigManage)).Methods(http.MethodGet)
+	approvalRoutes.Handle("/approve", allow(approvalHandler.Approve, auth.PermApprovalsDecide)).Methods(http.MethodPost)
+	approvalRoutes.Handle("/reject", allow(approvalHandler.Reject, auth.PermApprovalsDecide)).Methods(http.MethodPost)
+
+	// Accounting period endpoints (protected)
+	periodRoutes := router.PathPrefix("/api/periods").Subrouter()
+	periodRoutes.Use(requireAuth)
+	periodRoutes.Handle("", allow(periodHandler.GetPeriods, auth.PermReportsView)).Methods(http.MethodGet)
+	periodRoutes.Handle("/close", allow(periodHandler.Close, auth.PermPeriodsClose)).Methods(http.MethodPost)
+	periodRoutes.Handle("/reopen", allow(periodHandler.Reopen, auth.PermPeriodsClose)).Methods(http.MethodPost)
+
+	// Audit log endpoints (protected)
+	auditRoutes := router.PathPrefix("/api/audit-log").Subrouter()
+	auditRoutes.Use(requireAuth)
+	auditRoutes.Handle("", allow(auditHandler.GetAuditLog, auth.PermAuditRead)).Methods(http.MethodGet)
+
+	// Scheduled reconciliation
+	if cfg.Reconcile.IntervalMinutes > 0 {
+		stop := reconciliationService.Schedule(time.Duration(cfg.Reconcile.IntervalMinutes)*time.Minute, cfg.Reconcile.AutoFix)
+		defer stop()
+		log.Printf("🔁 Balance reconciliation every %d minutes (auto-fix: %t)", cfg.Reconcile.IntervalMinutes, cfg.Reconcile.AutoFix)
+	}
 
 	// Setup CORS
 	c := cors.New(cors.Options{
 		AllowedOrigins: cfg.CORS.AllowedOrigins,
 		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
 		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{"Retry-After", "Idempotent-Replayed", "ETag"},
 		MaxAge:         3600,
 	})
 
-	handler := c.Handler(router)
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	handler := c.Handler(middleware.RealIP(trustedProxies)(router))
 
 	// Start server
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
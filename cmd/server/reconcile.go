@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/services"
+	"os"
+	"time"
+)
+
+// runReconcile implements `backend-go-server reconcile [-fix]`. It exits 0
+// when all balances match (or were fixed), 2 when mismatches remain and 1 on
+// errors, so it can be used from cron.
+func runReconcile(db *database.DB, args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "repair mismatched balances")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	service := services.NewReconciliationService(db, services.NewSecurityEventService(db))
+	report, err := service.Reconcile(*fix, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reconcile: %v\n", err)
+		return 1
+	}
+
+	for _, m := range report.Mismatches {
+		status := "MISMATCH"
+		if m.Fixed {
+			status = "FIXED"
+		}
+		fmt.Printf("%-8s %-10s total %s (expected %s)  last_transaction %s (expected %s)\n",
+			status, m.CustomerID, m.StoredTotal, m.ExpectedTotal,
+			formatTime(m.StoredLastTransaction), formatTime(m.ExpectedLastTransaction))
+	}
+	fmt.Printf("%d customers checked, %d mismatches, %d fixed\n", report.Checked, len(report.Mismatches), report.Fixed)
+
+	if len(report.Mismatches) > report.Fixed {
+		return 2
+	}
+	return 0
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
@@ -8,4 +8,7 @@ require (
 	github.com/gorilla/mux v1.8.1
 	github.com/joho/godotenv v1.5.1
 	github.com/rs/cors v1.10.1
+	golang.org/x/crypto v0.17.0
 )
+
+require golang.org/x/sys v0.15.0 // indirect
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims represents the JWT claims issued at login and on token refresh.
+// The same type is used to sign and to verify tokens.
+type Claims struct {
+	UserID       string `json:"user_id"`
+	Role         string `json:"role"`
+	SessionID    string `json:"sid"`
+	TokenVersion int    `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+// SignToken signs claims with HS256
+func SignToken(claims *Claims, secret string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	tokenString, err := token.SignedString([]byte(secret))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// ParseToken verifies the signature and expiry of a token and returns its claims
+func ParseToken(tokenString, secret string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Client types reported in the X-Client-Type header
+const (
+	ClientWeb    = "web"
+	ClientMobile = "mobile"
+)
+
+// Headers clients use to identify themselves
+const (
+	HeaderClientType = "X-Client-Type"
+	HeaderAppVersion = "X-App-Version"
+)
+
+// ClientTypeFromRequest returns the client type of a request. Requests that
+// do not identify themselves are treated as web clients.
+func ClientTypeFromRequest(r *http.Request) string {
+	if strings.EqualFold(strings.TrimSpace(r.Header.Get(HeaderClientType)), ClientMobile) {
+		return ClientMobile
+	}
+	return ClientWeb
+}
+
+// AppVersionFromRequest returns the app version a mobile client reports
+func AppVersionFromRequest(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get(HeaderAppVersion))
+}
@@ -0,0 +1,113 @@
+package auth
+
+import "strings"
+
+// Roles
+const (
+	RoleAdmin     = "admin"
+	RoleBendahara = "bendahara" // treasurer
+	RoleKetuaRT   = "ketua_rt"  // RT chairman
+	RolePetugas   = "petugas"   // collector
+	RoleWarga     = "warga"     // read-only resident
+)
+
+// Permission is a single capability checked by route policies and services
+type Permission string
+
+// Permissions
+const (
+	PermUsersRead             Permission = "users.read"
+	PermUsersWrite            Permission = "users.write"
+	PermCustomersRead         Permission = "customers.read"
+	PermCustomersWrite        Permission = "customers.write"
+	PermTransactionsRead      Permission = "transactions.read"
+	PermTransactionsReadOwn   Permission = "transactions.read.own"
+	PermTransactionsCreate    Permission = "transactions.create"
+	PermTransactionsOnBehalf  Permission = "transactions.create.on_behalf"
+	PermTransactionsDeleteOwn Permission = "transactions.delete.own"
+	PermTransactionsDeleteAny Permission = "transactions.delete.any"
+	PermTransactionsUpdate    Permission = "transactions.update"
+	PermReportsView           Permission = "reports.view"
+	PermConfigManage          Permission = "config.manage"
+	PermConfigApprove         Permission = "config.approve" // approve relaxing the approval rules
+	PermLedgerReconcile       Permission = "ledger.reconcile"
+	PermAuditRead             Permission = "audit.read"
+	PermApprovalsDecide       Permission = "approvals.decide"
+	PermPeriodsClose          Permission = "periods.close"
+	PermPeriodsReopen         Permission = "periods.reopen" // approve reopening a closed period
+)
+
+// rolePermissions maps every role to the permissions it grants
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermUsersRead, PermUsersWrite,
+		PermCustomersRead, PermCustomersWrite,
+		PermTransactionsRead, PermTransactionsReadOwn, PermTransactionsCreate, PermTransactionsOnBehalf,
+		PermTransactionsDeleteOwn, PermTransactionsDeleteAny, PermTransactionsUpdate,
+		PermReportsView,
+		PermConfigManage,
+		PermLedgerReconcile,
+		PermAuditRead,
+		PermApprovalsDecide,
+		PermPeriodsClose, PermPeriodsReopen,
+	},
+	RoleBendahara: {
+		PermCustomersRead,
+		PermTransactionsRead, PermTransactionsReadOwn, PermTransactionsCreate,
+		PermTransactionsDeleteOwn, PermTransactionsDeleteAny, PermTransactionsUpdate,
+		PermReportsView,
+		PermPeriodsClose,
+	},
+	RoleKetuaRT: {
+		PermUsersRead,
+		PermCustomersRead,
+		PermTransactionsRead,
+		PermReportsView,
+		PermApprovalsDecide,
+		PermConfigApprove,
+	},
+	RolePetugas: {
+		PermCustomersRead,
+		PermTransactionsReadOwn, PermTransactionsCreate, PermTransactionsDeleteOwn,
+	},
+	RoleWarga: {
+		PermReportsView,
+	},
+}
+
+// Roles returns all known roles
+func Roles() []string {
+	return []string{RoleAdmin, RoleBendahara, RoleKetuaRT, RolePetugas, RoleWarga}
+}
+
+// IsValidRole reports whether role is a known role
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleList returns the known roles formatted for error messages
+func RoleList() string {
+	return "'" + strings.Join(Roles(), "', '") + "'"
+}
+
+// HasPermission reports whether role grants perm
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrivilegedRole reports whether role can manage users or decide approval
+// requests, so granting it needs the same scrutiny as a role change
+func IsPrivilegedRole(role string) bool {
+	return HasPermission(role, PermUsersWrite) || HasPermission(role, PermApprovalsDecide)
+}
+
+// Can reports whether the principal's role grants perm
+func (p *Principal) Can(perm Permission) bool {
+	return HasPermission(p.Role, perm)
+}
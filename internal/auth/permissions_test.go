@@ -0,0 +1,19 @@
+package auth
+
+import "testing"
+
+func TestIsPrivilegedRole(t *testing.T) {
+	want := map[string]bool{
+		RoleAdmin:     true,
+		RoleKetuaRT:   true,
+		RoleBendahara: false,
+		RolePetugas:   false,
+		RoleWarga:     false,
+		"unknown":     false,
+	}
+	for role, privileged := range want {
+		if got := IsPrivilegedRole(role); got != privileged {
+			t.Errorf("IsPrivilegedRole(%q) = %t, want %t", role, got, privileged)
+		}
+	}
+}
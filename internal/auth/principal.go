@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID    string
+	Role      string
+	SessionID string
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored by the auth middleware
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// PrincipalFromRequest returns the principal of an authenticated request
+func PrincipalFromRequest(r *http.Request) (*Principal, bool) {
+	return PrincipalFromContext(r.Context())
+}
@@ -5,15 +5,18 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	JWT      JWTConfig
-	CORS     CORSConfig
+	Database  DatabaseConfig
+	Server    ServerConfig
+	JWT       JWTConfig
+	TwoFactor TwoFactorConfig
+	Reconcile ReconcileConfig
+	CORS      CORSConfig
 }
 
 type DatabaseConfig struct {
@@ -25,13 +28,25 @@ type DatabaseConfig struct {
 }
 
 type ServerConfig struct {
-	Port int
-	Env  string
+	Port           int
+	Env            string
+	TrustedProxies []string // IPs or CIDRs whose X-Forwarded-For / X-Real-IP headers are trusted
 }
 
 type JWTConfig struct {
-	Secret       string
-	ExpiryHours  int
+	Secret              string
+	AccessExpiryMinutes int // lifetime of access tokens
+	RefreshExpiryHours  int // lifetime of refresh tokens and their session
+}
+
+type TwoFactorConfig struct {
+	Issuer        string   // shown in authenticator apps
+	RequiredRoles []string // roles that must enroll before they can log in
+}
+
+type ReconcileConfig struct {
+	IntervalMinutes int  // run the balance reconciler every N minutes; 0 disables it
+	AutoFix         bool // repair mismatches found by scheduled runs
 }
 
 type CORSConfig struct {
@@ -44,7 +59,10 @@ func Load() *Config {
 
 	dbPort, _ := strconv.Atoi(getEnv("DB_PORT", "3306"))
 	serverPort, _ := strconv.Atoi(getEnv("PORT", "8080"))
-	jwtExpiry, _ := strconv.Atoi(getEnv("JWT_EXPIRY_HOURS", "168"))
+	accessExpiry, _ := strconv.Atoi(getEnv("JWT_ACCESS_EXPIRY_MINUTES", "15"))
+	refreshExpiry, _ := strconv.Atoi(getEnv("JWT_REFRESH_EXPIRY_HOURS", getEnv("JWT_EXPIRY_HOURS", "168")))
+	reconcileInterval, _ := strconv.Atoi(getEnv("RECONCILE_INTERVAL_MINUTES", "0"))
+	reconcileAutoFix, _ := strconv.ParseBool(getEnv("RECONCILE_AUTO_FIX", "false"))
 
 	corsOrigins := []string{
 		"http://localhost:3000",
@@ -64,12 +82,22 @@ func Load() *Config {
 			Name:     getEnv("DB_NAME", "jimpitan"),
 		},
 		Server: ServerConfig{
-			Port: serverPort,
-			Env:  getEnv("ENV", "development"),
+			Port:           serverPort,
+			Env:            getEnv("ENV", "development"),
+			TrustedProxies: getEnvList("TRUSTED_PROXIES"),
 		},
 		JWT: JWTConfig{
-			Secret:      getEnv("JWT_SECRET", "change-me-in-production"),
-			ExpiryHours: jwtExpiry,
+			Secret:              getEnv("JWT_SECRET", "change-me-in-production"),
+			AccessExpiryMinutes: accessExpiry,
+			RefreshExpiryHours:  refreshExpiry,
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer:        getEnv("TWO_FACTOR_ISSUER", "Jimpitan"),
+			RequiredRoles: getEnvList("TWO_FACTOR_REQUIRED_ROLES"),
+		},
+		Reconcile: ReconcileConfig{
+			IntervalMinutes: reconcileInterval,
+			AutoFix:         reconcileAutoFix,
 		},
 		CORS: CORSConfig{
 			AllowedOrigins: corsOrigins,
@@ -90,6 +118,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList reads a comma-separated list, skipping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 func (c *DatabaseConfig) DSN() string {
 	return fmt.Sprintf(
 		"%s:%s@tcp(%s:%d)/%s?parseTime=true&loc=Local",
@@ -0,0 +1,38 @@
+package database
+
+import "fmt"
+
+// Sequence names in the id_sequences table
+const (
+	SeqUsers        = "users"
+	SeqCustomers    = "customers"
+	SeqTransactions = "transactions"
+)
+
+// NextSequence allocates the next value of a named sequence. The increment is
+// a single atomic UPDATE, so values are unique across concurrent requests and
+// server instances. When exec is a *sql.Tx the row stays locked until the
+// transaction ends and a rollback gives the value back.
+func NextSequence(exec Execer, name string) (int64, error) {
+	// LAST_INSERT_ID(expr) makes the new value come back as the result's
+	// insert id without a second query on a possibly different connection
+	result, err := exec.Exec("UPDATE id_sequences SET value = LAST_INSERT_ID(value + 1) WHERE name = ?", name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate %s id: %w", name, err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return 0, fmt.Errorf("sequence %s not found, run the id_sequences migration", name)
+	}
+
+	value, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate %s id: %w", name, err)
+	}
+	return value, nil
+}
+
+// NextSequence allocates the next value of a named sequence outside a transaction
+func (db *DB) NextSequence(name string) (int64, error) {
+	return NextSequence(db, name)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"jimpitan/backend/internal/services"
+	"net/http"
+	"strconv"
+)
+
+type ApprovalHandler struct {
+	approvalService *services.ApprovalService
+}
+
+func NewApprovalHandler(approvalService *services.ApprovalService) *ApprovalHandler {
+	return &ApprovalHandler{approvalService: approvalService}
+}
+
+// GetApprovals lists approval requests, optionally filtered by the status
+// query parameter. Users without approvals.decide only see their own.
+func (h *ApprovalHandler) GetApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	requests, err := h.approvalService.List(r.URL.Query().Get("status"), principal)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Approval requests retrieved successfully", requests)
+}
+
+// Approve approves a pending request, which executes it
+func (h *ApprovalHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, true)
+}
+
+// Reject rejects a pending request; the body note is required
+func (h *ApprovalHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, false)
+}
+
+func (h *ApprovalHandler) decide(w http.ResponseWriter, r *http.Request, approve bool) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "id parameter is required")
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	if approve {
+		request, err := h.approvalService.Approve(id, req.Note, principal, auditActor(r))
+		if err != nil {
+			respondServiceError(w, http.StatusBadRequest, err)
+			return
+		}
+		respondSuccess(w, http.StatusOK, "Permintaan disetujui dan dijalankan", request)
+		return
+	}
+
+	request, err := h.approvalService.Reject(id, req.Note, principal, auditActor(r))
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondSuccess(w, http.StatusOK, "Permintaan ditolak", request)
+}
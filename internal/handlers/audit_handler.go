@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"jimpitan/backend/internal/models"
+	"jimpitan/backend/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{auditService: auditService}
+}
+
+// GetAuditLog lists audit entries, newest first. Filters: actor_id, action,
+// entity_type, entity_id, from and to (inclusive dates, YYYY-MM-DD), limit
+// and before_id for paging.
+func (h *AuditHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := models.AuditLogFilter{
+		ActorID:    q.Get("actor_id"),
+		Action:     q.Get("action"),
+		EntityType: q.Get("entity_type"),
+		EntityID:   q.Get("entity_id"),
+	}
+
+	if v := q.Get("from"); v != "" {
+		parsed, err := time.ParseInLocation(reportDateLayout, v, time.Local)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "from harus berformat YYYY-MM-DD")
+			return
+		}
+		filter.From = &parsed
+	}
+	if v := q.Get("to"); v != "" {
+		parsed, err := time.ParseInLocation(reportDateLayout, v, time.Local)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "to harus berformat YYYY-MM-DD")
+			return
+		}
+		to := parsed.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			respondError(w, http.StatusBadRequest, "limit harus berupa angka positif")
+			return
+		}
+		filter.Limit = limit
+	}
+	if v := q.Get("before_id"); v != "" {
+		beforeID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || beforeID <= 0 {
+			respondError(w, http.StatusBadRequest, "before_id tidak valid")
+			return
+		}
+		filter.BeforeID = beforeID
+	}
+
+	page, err := h.auditService.Query(filter)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Audit log retrieved successfully", page)
+}
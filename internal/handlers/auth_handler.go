@@ -2,9 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"jimpitan/backend/internal/auth"
 	"jimpitan/backend/internal/models"
 	"jimpitan/backend/internal/services"
+	"net"
 	"net/http"
+	"strconv"
 )
 
 type AuthHandler struct {
@@ -28,15 +32,92 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	loginResp, err := h.authService.Login(req.Username, req.Password)
+	client := clientInfoFromRequest(r)
+	client.DeviceName = req.DeviceName
+
+	loginResp, err := h.authService.Login(req.Username, req.Password, client)
 	if err != nil {
-		respondError(w, http.StatusUnauthorized, err.Error())
+		respondServiceError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	if loginResp.TwoFactor != nil {
+		respondSuccess(w, http.StatusOK, "Verifikasi dua langkah diperlukan", loginResp)
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Login berhasil", loginResp)
+}
+
+// LoginTwoFactor completes a login that returned a two-factor challenge
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req models.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	client := clientInfoFromRequest(r)
+	client.DeviceName = req.DeviceName
+
+	loginResp, err := h.authService.CompleteTwoFactor(req, client)
+	if err != nil {
+		respondServiceError(w, http.StatusUnauthorized, err)
 		return
 	}
 
 	respondSuccess(w, http.StatusOK, "Login berhasil", loginResp)
 }
 
+// LoginTwoFactorSetup returns the TOTP secret for a login that must enroll in 2FA first
+func (h *AuthHandler) LoginTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req models.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	setup, err := h.authService.BeginTwoFactorEnrollment(req.ChallengeToken)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Pindai kode QR dengan aplikasi autentikator", setup)
+}
+
+// RefreshToken rotates a refresh token and issues a new access token
+func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req models.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tokenResp, err := h.authService.RefreshToken(req.RefreshToken, clientInfoFromRequest(r))
+	if err != nil {
+		respondServiceError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Token berhasil diperbarui", tokenResp)
+}
+
 // VerifyToken verifies if token is valid
 func (h *AuthHandler) VerifyToken(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -57,12 +138,12 @@ func (h *AuthHandler) VerifyToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	respondSuccess(w, http.StatusOK, "Token valid", map[string]interface{}{
-		"id":            user.ID,
-		"name":          user.Name,
-		"role":          user.Role,
-		"username":      user.Username,
-		"token":         user.Token,
-		"token_expiry":  user.TokenExpiry,
+		"id":           user.ID,
+		"name":         user.Name,
+		"role":         user.Role,
+		"username":     user.Username,
+		"token":        user.Token,
+		"token_expiry": user.TokenExpiry,
 	})
 }
 
@@ -73,13 +154,12 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.Header.Get("X-User-ID")
-	if userID == "" {
-		respondError(w, http.StatusUnauthorized, "User ID not found in token")
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
-	if err := h.authService.Logout(userID); err != nil {
+	if err := h.authService.Logout(principal.UserID, principal.SessionID, auditActor(r)); err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to logout: "+err.Error())
 		return
 	}
@@ -117,3 +197,92 @@ func respondError(w http.ResponseWriter, statusCode int, message string) {
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// errorCodeStatus overrides the HTTP status for coded service errors
+var errorCodeStatus = map[string]int{
+	services.ErrCodeAccountLocked:        http.StatusLocked,
+	services.ErrCodeTooManyAttempts:      http.StatusTooManyRequests,
+	services.ErrCodeWebLoginDisabled:     http.StatusForbidden,
+	services.ErrCodeUpdateRequired:       http.StatusUpgradeRequired,
+	services.ErrCodeIdempotencyKeyReused: http.StatusUnprocessableEntity,
+	services.ErrCodeRestoreConflict:      http.StatusConflict,
+	services.ErrCodeAlreadyReversed:      http.StatusConflict,
+	services.ErrCodeApprovalFailed:       http.StatusConflict,
+	services.ErrCodePeriodClosed:         http.StatusConflict,
+}
+
+// respondServiceError writes a service error. Coded errors also carry their
+// code and details, and may use a more specific status than the default.
+func respondServiceError(w http.ResponseWriter, statusCode int, err error) {
+	var coded *services.CodedError
+	if !errors.As(err, &coded) {
+		respondError(w, statusCode, err.Error())
+		return
+	}
+
+	// A queued approval request is an accepted operation, not a failure
+	if coded.Code == services.ErrCodeApprovalRequired {
+		respondSuccess(w, http.StatusAccepted, coded.Message, coded.Details)
+		return
+	}
+
+	if status, ok := errorCodeStatus[coded.Code]; ok {
+		statusCode = status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if retry, ok := coded.Details["retry_after_seconds"].(int); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+	}
+	w.WriteHeader(statusCode)
+	response := models.GenericResponse{
+		Status:  "error",
+		Code:    coded.Code,
+		Message: coded.Message,
+	}
+	if len(coded.Details) > 0 {
+		response.Data = coded.Details
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// requirePrincipal returns the authenticated caller, or writes a 401 response
+// when the request did not pass through the auth middleware
+func requirePrincipal(w http.ResponseWriter, r *http.Request) (*auth.Principal, bool) {
+	principal, ok := auth.PrincipalFromRequest(r)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "User information not found")
+		return nil, false
+	}
+	return principal, true
+}
+
+// clientInfoFromRequest extracts the caller's user agent, IP address and
+// client identification headers
+func clientInfoFromRequest(r *http.Request) models.ClientInfo {
+	return models.ClientInfo{
+		UserAgent:  r.UserAgent(),
+		IPAddress:  clientIP(r),
+		ClientType: auth.ClientTypeFromRequest(r),
+		AppVersion: auth.AppVersionFromRequest(r),
+	}
+}
+
+// auditActor identifies the caller of r for the audit log
+func auditActor(r *http.Request) services.Actor {
+	actor := services.Actor{IPAddress: clientIP(r), UserAgent: r.UserAgent()}
+	if principal, ok := auth.PrincipalFromRequest(r); ok {
+		actor.UserID = principal.UserID
+	}
+	return actor
+}
+
+// clientIP returns the peer address of r. Forwarding headers are only
+// honoured by middleware.RealIP, for requests from a trusted proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
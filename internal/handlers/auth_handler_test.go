@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"jimpitan/backend/internal/models"
+	"jimpitan/backend/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespondServiceError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   string
+		code   string
+	}{
+		{"plain error", errors.New("gagal"), http.StatusBadRequest, "error", ""},
+		{"coded error", &services.CodedError{Code: services.ErrCodeAccountLocked, Message: "terkunci"}, http.StatusLocked, "error", services.ErrCodeAccountLocked},
+		{
+			"queued for approval",
+			&services.CodedError{
+				Code:    services.ErrCodeApprovalRequired,
+				Message: "menunggu persetujuan",
+				Details: map[string]interface{}{"approval_request": &models.ApprovalRequest{ID: 7, Status: models.ApprovalPending}},
+			},
+			http.StatusAccepted, "success", "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			respondServiceError(w, http.StatusBadRequest, tt.err)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			var resp struct {
+				Status string                 `json:"status"`
+				Code   string                 `json:"code"`
+				Data   map[string]interface{} `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.body || resp.Code != tt.code {
+				t.Errorf("body status %q code %q, want %q %q", resp.Status, resp.Code, tt.body, tt.code)
+			}
+			if tt.status == http.StatusAccepted && resp.Data["approval_request"] == nil {
+				t.Error("approval_request missing from the 202 response")
+			}
+		})
+	}
+}
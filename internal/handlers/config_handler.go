@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"jimpitan/backend/internal/models"
+	"jimpitan/backend/internal/services"
+	"net/http"
+)
+
+type ConfigHandler struct {
+	configService *services.ConfigService
+}
+
+func NewConfigHandler(configService *services.ConfigService) *ConfigHandler {
+	return &ConfigHandler{configService: configService}
+}
+
+// GetConfig returns the system configuration
+func (h *ConfigHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	cfg, err := h.configService.GetConfig()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Config retrieved successfully", cfg)
+}
+
+// UpdateConfig changes the system configuration
+func (h *ConfigHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req models.ConfigUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	cfg, err := h.configService.UpdateConfig(req, auditActor(r))
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Config updated successfully", cfg)
+}
@@ -71,7 +71,7 @@ func (h *CustomerHandler) CreateCustomer(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	customer, err := h.customerService.CreateCustomer(req.Blok, req.Nama)
+	customer, err := h.customerService.CreateCustomer(req.Blok, req.Nama, auditActor(r))
 	if err != nil {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
@@ -103,7 +103,7 @@ func (h *CustomerHandler) UpdateCustomer(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.customerService.UpdateCustomer(id, req.Blok, req.Nama); err != nil {
+	if err := h.customerService.UpdateCustomer(id, req.Blok, req.Nama, auditActor(r)); err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -124,7 +124,7 @@ func (h *CustomerHandler) DeleteCustomer(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.customerService.DeleteCustomer(id); err != nil {
+	if err := h.customerService.DeleteCustomer(id, auditActor(r)); err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -176,7 +176,7 @@ func (h *CustomerHandler) BulkDeleteCustomers(w http.ResponseWriter, r *http.Req
 	}
 
 	for _, id := range req.IDs {
-		if err := h.customerService.DeleteCustomer(id); err != nil {
+		if err := h.customerService.DeleteCustomer(id, auditActor(r)); err != nil {
 			respondError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -184,3 +184,42 @@ func (h *CustomerHandler) BulkDeleteCustomers(w http.ResponseWriter, r *http.Req
 
 	respondSuccess(w, http.StatusOK, "Customers deleted successfully", map[string]int{"deleted_count": len(req.IDs)})
 }
+
+// GetTrash lists soft-deleted customers
+func (h *CustomerHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	customers, err := h.customerService.GetDeletedCustomers()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Deleted customers retrieved successfully", map[string]interface{}{
+		"customers": customers,
+	})
+}
+
+// Restore undoes a soft delete
+func (h *CustomerHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "id parameter is required")
+		return
+	}
+
+	if err := h.customerService.RestoreCustomer(id, auditActor(r)); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Customer berhasil dipulihkan", nil)
+}
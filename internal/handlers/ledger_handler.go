@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"jimpitan/backend/internal/services"
+	"net/http"
+)
+
+type LedgerHandler struct {
+	ledgerChainService *services.LedgerChainService
+}
+
+func NewLedgerHandler(ledgerChainService *services.LedgerChainService) *LedgerHandler {
+	return &LedgerHandler{ledgerChainService: ledgerChainService}
+}
+
+// Verify walks the ledger hash chain and reports the first broken link
+func (h *LedgerHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	report, err := h.ledgerChainService.Verify()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	message := "Rantai ledger utuh"
+	if !report.Valid {
+		message = "Rantai ledger rusak"
+	}
+	respondSuccess(w, http.StatusOK, message, report)
+}
+
+// GetHead returns the chain head at the end of the month query parameter
+// (YYYY-MM), or the current head when it is omitted
+func (h *LedgerHandler) GetHead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	head, err := h.ledgerChainService.MonthHead(r.URL.Query().Get("month"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Chain head retrieved successfully", head)
+}
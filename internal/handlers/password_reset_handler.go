@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"jimpitan/backend/internal/models"
+	"jimpitan/backend/internal/services"
+	"net/http"
+)
+
+type PasswordResetHandler struct {
+	passwordResetService *services.PasswordResetService
+}
+
+func NewPasswordResetHandler(passwordResetService *services.PasswordResetService) *PasswordResetHandler {
+	return &PasswordResetHandler{passwordResetService: passwordResetService}
+}
+
+// IssueCode creates a one-time password reset code for a user
+func (h *PasswordResetHandler) IssueCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "id parameter is required")
+		return
+	}
+
+	code, err := h.passwordResetService.IssueCode(id, auditActor(r))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusCreated, "Kode reset password berhasil dibuat", code)
+}
+
+// Redeem sets a new password with a reset code
+func (h *PasswordResetHandler) Redeem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req models.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.passwordResetService.Redeem(req, auditActor(r)); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Password berhasil direset, silakan login kembali", nil)
+}
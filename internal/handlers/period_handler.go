@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"jimpitan/backend/internal/services"
+	"net/http"
+)
+
+type PeriodHandler struct {
+	periodService *services.PeriodService
+}
+
+func NewPeriodHandler(periodService *services.PeriodService) *PeriodHandler {
+	return &PeriodHandler{periodService: periodService}
+}
+
+// GetPeriods lists closed and reopened periods with their snapshots
+func (h *PeriodHandler) GetPeriods(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	periods, err := h.periodService.GetPeriods()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Periods retrieved successfully", periods)
+}
+
+// Close closes the month in the period query parameter (YYYY-MM)
+func (h *PeriodHandler) Close(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		respondError(w, http.StatusBadRequest, "period parameter is required")
+		return
+	}
+
+	closed, err := h.periodService.ClosePeriod(period, principal, auditActor(r))
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Periode berhasil ditutup", closed)
+}
+
+// Reopen requests reopening a closed period; it always needs approval
+func (h *PeriodHandler) Reopen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		respondError(w, http.StatusBadRequest, "period parameter is required")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	request, err := h.periodService.ReopenPeriod(period, req.Reason, auditActor(r))
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondSuccess(w, http.StatusAccepted, services.PendingMessage(request), map[string]interface{}{"approval_request": request})
+}
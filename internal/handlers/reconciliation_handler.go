@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"jimpitan/backend/internal/services"
+	"net/http"
+)
+
+type ReconciliationHandler struct {
+	reconciliationService *services.ReconciliationService
+}
+
+func NewReconciliationHandler(reconciliationService *services.ReconciliationService) *ReconciliationHandler {
+	return &ReconciliationHandler{reconciliationService: reconciliationService}
+}
+
+// Check reports customers whose balance disagrees with the ledger
+func (h *ReconciliationHandler) Check(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	report, err := h.reconciliationService.Reconcile(false, "")
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Rekonsiliasi selesai", report)
+}
+
+// Repair recomputes and fixes every mismatched customer balance
+func (h *ReconciliationHandler) Repair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.reconciliationService.Reconcile(true, principal.UserID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Saldo customer berhasil diperbaiki", report)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"jimpitan/backend/internal/services"
+	"net/http"
+	"time"
+)
+
+const reportDateLayout = "2006-01-02"
+
+type ReportHandler struct {
+	reportService *services.ReportService
+}
+
+func NewReportHandler(reportService *services.ReportService) *ReportHandler {
+	return &ReportHandler{reportService: reportService}
+}
+
+// GetSummary returns deposit totals per blok and per petugas.
+// from and to are inclusive dates (YYYY-MM-DD); defaults to the current month.
+func (h *ReportHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 1, 0)
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		parsed, err := time.ParseInLocation(reportDateLayout, v, time.Local)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "from harus berformat YYYY-MM-DD")
+			return
+		}
+		from = parsed
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		parsed, err := time.ParseInLocation(reportDateLayout, v, time.Local)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "to harus berformat YYYY-MM-DD")
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	summary, err := h.reportService.GetSummary(from, to)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Report retrieved successfully", summary)
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"jimpitan/backend/internal/services"
+	"net/http"
+)
+
+type SessionHandler struct {
+	sessionService *services.SessionService
+}
+
+func NewSessionHandler(sessionService *services.SessionService) *SessionHandler {
+	return &SessionHandler{sessionService: sessionService}
+}
+
+// GetMySessions returns the current user's active sessions
+func (h *SessionHandler) GetMySessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessionService.GetUserSessions(principal.UserID, principal.SessionID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Sessions retrieved successfully", map[string]interface{}{
+		"sessions": sessions,
+	})
+}
+
+// RevokeMySession revokes one of the current user's sessions
+func (h *SessionHandler) RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "id parameter is required")
+		return
+	}
+
+	if err := h.sessionService.RevokeSession(principal.UserID, id); err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Sesi berhasil diakhiri", nil)
+}
+
+// RevokeAllMySessions revokes every session of the current user, including this one
+func (h *SessionHandler) RevokeAllMySessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := h.sessionService.RevokeAllSessions(principal.UserID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Semua sesi berhasil diakhiri", map[string]int64{"revoked_count": revoked})
+}
+
+// GetUserSessions returns the active sessions of any user (admin only)
+func (h *SessionHandler) GetUserSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		respondError(w, http.StatusBadRequest, "user_id parameter is required")
+		return
+	}
+
+	sessions, err := h.sessionService.GetUserSessions(userID, principal.SessionID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Sessions retrieved successfully", map[string]interface{}{
+		"sessions": sessions,
+	})
+}
+
+// RevokeUserSessions revokes one session (id) or all sessions of any user (admin only)
+func (h *SessionHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		respondError(w, http.StatusBadRequest, "user_id parameter is required")
+		return
+	}
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		if err := h.sessionService.RevokeSession(userID, id); err != nil {
+			respondError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		respondSuccess(w, http.StatusOK, "Sesi berhasil diakhiri", map[string]int64{"revoked_count": 1})
+		return
+	}
+
+	revoked, err := h.sessionService.RevokeAllSessions(userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Semua sesi user berhasil diakhiri", map[string]int64{"revoked_count": revoked})
+}
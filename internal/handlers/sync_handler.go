@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"jimpitan/backend/internal/models"
+	"jimpitan/backend/internal/services"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type SyncHandler struct {
+	transactionService *services.TransactionService
+	customerService    *services.CustomerService
+}
+
+func NewSyncHandler(transactionService *services.TransactionService, customerService *services.CustomerService) *SyncHandler {
+	return &SyncHandler{transactionService: transactionService, customerService: customerService}
+}
+
+// SyncTransactions uploads a batch of deposits recorded offline
+func (h *SyncHandler) SyncTransactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SyncTransactionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	results, err := h.transactionService.SyncTransactions(req.Transactions, principal, auditActor(r))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	counts := map[string]int{
+		models.SyncAccepted:  0,
+		models.SyncDuplicate: 0,
+		models.SyncRejected:  0,
+	}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	respondSuccess(w, http.StatusOK, "Sinkronisasi selesai", map[string]interface{}{
+		"results":         results,
+		"accepted_count":  counts[models.SyncAccepted],
+		"duplicate_count": counts[models.SyncDuplicate],
+		"rejected_count":  counts[models.SyncRejected],
+	})
+}
+
+// SyncCustomers returns customer directory changes since ?cursor= for the
+// offline QR cache. Supports If-None-Match so unchanged pages cost no body.
+func (h *SyncHandler) SyncCustomers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			respondError(w, http.StatusBadRequest, "limit harus berupa angka positif")
+			return
+		}
+		limit = parsed
+	}
+
+	page, err := h.customerService.SyncCustomers(r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithETag(w, r, "Customer changes retrieved successfully", page)
+}
+
+// respondWithETag writes a success response tagged with a hash of its data,
+// or 304 Not Modified when the client already holds that version
+func respondWithETag(w http.ResponseWriter, r *http.Request, message string, data interface{}) {
+	body, err := json.Marshal(models.GenericResponse{
+		Status:  "success",
+		Message: message,
+		Data:    data,
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"jimpitan/backend/internal/models"
 	"jimpitan/backend/internal/services"
 	"net/http"
+	"strings"
 )
 
 type TransactionHandler struct {
@@ -38,13 +41,12 @@ func (h *TransactionHandler) GetMyHistory(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	userID := r.Header.Get("X-User-ID")
-	if userID == "" {
-		respondError(w, http.StatusUnauthorized, "User information not found")
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
-	transactions, err := h.transactionService.GetUserTransactions(userID)
+	transactions, err := h.transactionService.GetUserTransactions(principal.UserID)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -53,55 +55,83 @@ func (h *TransactionHandler) GetMyHistory(w http.ResponseWriter, r *http.Request
 	respondSuccess(w, http.StatusOK, "User transactions retrieved successfully", transactions)
 }
 
-// SubmitTransaction creates a new transaction
+// SubmitTransaction creates a new transaction. Clients should send an
+// Idempotency-Key header (or client_request_id) so retries are not recorded twice.
 func (h *TransactionHandler) SubmitTransaction(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	var req struct {
-		CustomerID string  `json:"customer_id"`
-		Blok       string  `json:"blok"`
-		Nama       string  `json:"nama"`
-		Nominal    float64 `json:"nominal"`
-		UserID     string  `json:"user_id"`
-		Petugas    string  `json:"petugas"`
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
 	}
 
+	var req models.SubmitTransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var moneyErr *models.MoneyError
+		if errors.As(err, &moneyErr) {
+			respondError(w, http.StatusBadRequest, moneyErr.Error())
+			return
+		}
 		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	transaction, err := h.transactionService.SubmitTransaction(
-		req.CustomerID,
-		req.Blok,
-		req.Nama,
-		req.UserID,
-		req.Petugas,
-		req.Nominal,
-	)
+	idempotencyKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if idempotencyKey == "" {
+		idempotencyKey = strings.TrimSpace(req.ClientRequestID)
+	}
+
+	transaction, replayed, err := h.transactionService.SubmitTransaction(req, principal, idempotencyKey, auditActor(r))
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+		respondSuccess(w, http.StatusOK, "Transaksi sudah tercatat sebelumnya", transaction)
 		return
 	}
 
 	respondSuccess(w, http.StatusCreated, "Transaksi berhasil ditambahkan", transaction)
 }
 
-// DeleteTransaction soft deletes a single transaction with validation
+// DeleteTransaction cancels a transaction by recording a reversal entry;
+// the reason is passed as the reason query parameter
 func (h *TransactionHandler) DeleteTransaction(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	userID := r.Header.Get("X-User-ID")
-	userRole := r.Header.Get("X-User-Role")
+	h.reverse(w, r, r.URL.Query().Get("reason"))
+}
+
+// ReverseTransaction cancels a transaction by recording a reversal entry
+func (h *TransactionHandler) ReverseTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
 
-	if userID == "" || userRole == "" {
-		respondError(w, http.StatusUnauthorized, "User information not found")
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	h.reverse(w, r, req.Reason)
+}
+
+func (h *TransactionHandler) reverse(w http.ResponseWriter, r *http.Request, reason string) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
@@ -111,29 +141,30 @@ func (h *TransactionHandler) DeleteTransaction(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	if err := h.transactionService.DeleteTransactionWithValidation(id, userID, userRole); err != nil {
-		respondError(w, http.StatusForbidden, err.Error())
+	reversal, err := h.transactionService.ReverseTransaction(id, reason, principal, auditActor(r))
+	if err != nil {
+		respondServiceError(w, http.StatusForbidden, err)
 		return
 	}
 
-	respondSuccess(w, http.StatusOK, "Transaksi berhasil dihapus", nil)
+	respondSuccess(w, http.StatusCreated, "Transaksi berhasil dibatalkan", reversal)
 }
 
-// BulkDeleteTransactions soft deletes multiple transactions (admin only)
+// BulkDeleteTransactions reverses multiple transactions with one reason (requires transactions.delete.any)
 func (h *TransactionHandler) BulkDeleteTransactions(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	userRole := r.Header.Get("X-User-Role")
-	if userRole != "admin" {
-		respondError(w, http.StatusForbidden, "Hanya admin yang dapat menghapus transaksi massal")
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
 	var req struct {
-		IDs []string `json:"ids"`
+		IDs    []string `json:"ids"`
+		Reason string   `json:"reason"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -146,19 +177,125 @@ func (h *TransactionHandler) BulkDeleteTransactions(w http.ResponseWriter, r *ht
 		return
 	}
 
-	deleted, errors := h.transactionService.BulkDeleteTransactions(req.IDs)
+	reversed, errors, err := h.transactionService.BulkReverseTransactions(req.IDs, req.Reason, principal, auditActor(r))
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
 
-	if len(errors) > 0 && deleted == 0 {
-		respondError(w, http.StatusInternalServerError, "Semua transaksi gagal dihapus")
+	if len(errors) > 0 && reversed == 0 {
+		respondError(w, http.StatusInternalServerError, "Semua transaksi gagal dibatalkan")
 		return
 	}
 
 	response := map[string]interface{}{
-		"deleted": deleted,
+		"reversed": reversed,
 	}
 	if len(errors) > 0 {
 		response["errors"] = errors
 	}
 
-	respondSuccess(w, http.StatusOK, fmt.Sprintf("%d transaksi berhasil dihapus", deleted), response)
+	respondSuccess(w, http.StatusOK, fmt.Sprintf("%d transaksi berhasil dibatalkan", reversed), response)
+}
+
+// UpdateTransaction corrects the customer, nominal or notes of a transaction
+func (h *TransactionHandler) UpdateTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "id parameter is required")
+		return
+	}
+
+	var req models.UpdateTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var moneyErr *models.MoneyError
+		if errors.As(err, &moneyErr) {
+			respondError(w, http.StatusBadRequest, moneyErr.Error())
+			return
+		}
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	transaction, err := h.transactionService.UpdateTransaction(id, req, principal, auditActor(r))
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Transaksi berhasil diubah", transaction)
+}
+
+// GetRevisions lists the edits of a transaction
+func (h *TransactionHandler) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "id parameter is required")
+		return
+	}
+
+	revisions, err := h.transactionService.GetTransactionRevisions(id, principal)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Revisions retrieved successfully", revisions)
+}
+
+// GetTrash lists soft-deleted transactions
+func (h *TransactionHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	transactions, err := h.transactionService.GetDeletedTransactions()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Deleted transactions retrieved successfully", transactions)
+}
+
+// Restore undoes a soft delete
+func (h *TransactionHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "id parameter is required")
+		return
+	}
+
+	if err := h.transactionService.RestoreTransaction(id, auditActor(r)); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Transaksi berhasil dipulihkan", nil)
 }
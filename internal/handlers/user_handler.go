@@ -51,9 +51,9 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userService.CreateUser(req.Name, req.Role, req.Username, req.Password)
+	user, err := h.userService.CreateUser(req.Name, req.Role, req.Username, req.Password, auditActor(r))
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+		respondServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 
@@ -84,8 +84,8 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userService.UpdateUser(id, req.Name, req.Role, req.Username); err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+	if err := h.userService.UpdateUser(id, req.Name, req.Role, req.Username, auditActor(r)); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 
@@ -99,9 +99,8 @@ func (h *UserHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.Header.Get("X-User-ID")
-	if userID == "" {
-		respondError(w, http.StatusUnauthorized, "User ID not found in token")
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
@@ -115,7 +114,7 @@ func (h *UserHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userService.UpdatePassword(userID, req.OldPassword, req.NewPassword); err != nil {
+	if err := h.userService.UpdatePassword(principal.UserID, req.OldPassword, req.NewPassword, auditActor(r)); err != nil {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -136,7 +135,7 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userService.DeleteUser(id); err != nil {
+	if err := h.userService.DeleteUser(id, auditActor(r)); err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -144,6 +143,27 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	respondSuccess(w, http.StatusOK, "User deleted successfully", nil)
 }
 
+// UnlockUser lifts a login lockout on a user account
+func (h *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "id parameter is required")
+		return
+	}
+
+	if err := h.userService.UnlockUser(id, auditActor(r)); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Akun berhasil dibuka kembali", nil)
+}
+
 // GetUserActivity returns all transactions for a user
 func (h *UserHandler) GetUserActivity(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -187,10 +207,50 @@ func (h *UserHandler) BulkDeleteUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userService.BulkDeleteUsers(req.IDs); err != nil {
+	deleted, err := h.userService.BulkDeleteUsers(req.IDs, auditActor(r))
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "Users deleted successfully", map[string]int{"deleted_count": deleted})
+}
+
+// GetTrash lists soft-deleted users
+func (h *UserHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	users, err := h.userService.GetDeletedUsers()
+	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	respondSuccess(w, http.StatusOK, "Users deleted successfully", map[string]int{"deleted_count": len(req.IDs)})
+	respondSuccess(w, http.StatusOK, "Deleted users retrieved successfully", map[string]interface{}{
+		"users": users,
+	})
+}
+
+// Restore undoes a soft delete
+func (h *UserHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "id parameter is required")
+		return
+	}
+
+	if err := h.userService.RestoreUser(id, auditActor(r)); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondSuccess(w, http.StatusOK, "User berhasil dipulihkan", nil)
 }
@@ -1,24 +1,32 @@
 package middleware
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"jimpitan/backend/internal/auth"
 	"jimpitan/backend/internal/config"
 	"jimpitan/backend/internal/models"
+	"jimpitan/backend/internal/services"
 	"net/http"
 	"strings"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
-// Claims represents JWT claims
-type Claims struct {
-	UserID string
-	Role   string
-	jwt.RegisteredClaims
+// SessionValidator reports whether the session behind a token is still active
+// and the token has not been revoked
+type SessionValidator interface {
+	ValidateSession(sessionID, userID string, tokenVersion int) error
+}
+
+// ClientPolicy decides whether a user with role may use the API from client.
+// Rejections are returned as *services.CodedError.
+type ClientPolicy interface {
+	CheckClient(role string, client models.ClientInfo) error
 }
 
-// AuthMiddleware checks JWT token validity
-func AuthMiddleware(cfg *config.JWTConfig) func(http.Handler) http.Handler {
+// AuthMiddleware checks JWT token validity, that it has not been revoked and
+// that the client (web or mobile app version) is still allowed for the user
+func AuthMiddleware(cfg *config.JWTConfig, sessions SessionValidator, clients ClientPolicy) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			token := extractToken(r)
@@ -27,31 +35,58 @@ func AuthMiddleware(cfg *config.JWTConfig) func(http.Handler) http.Handler {
 				return
 			}
 
-			claims, err := verifyToken(token, cfg.Secret)
+			claims, err := auth.ParseToken(token, cfg.Secret)
 			if err != nil {
 				respondError(w, http.StatusUnauthorized, "Token tidak valid atau sudah kadaluarsa")
 				return
 			}
 
-			// Store claims in context (you can use context.WithValue if needed)
-			r.Header.Set("X-User-ID", claims.UserID)
-			r.Header.Set("X-User-Role", claims.Role)
+			if err := sessions.ValidateSession(claims.SessionID, claims.UserID, claims.TokenVersion); err != nil {
+				respondError(w, http.StatusUnauthorized, "Sesi sudah berakhir, silakan login kembali")
+				return
+			}
+
+			client := models.ClientInfo{
+				ClientType: auth.ClientTypeFromRequest(r),
+				AppVersion: auth.AppVersionFromRequest(r),
+			}
+			if err := clients.CheckClient(claims.Role, client); err != nil {
+				respondClientRejected(w, err)
+				return
+			}
+
+			ctx := auth.WithPrincipal(r.Context(), &auth.Principal{
+				UserID:    claims.UserID,
+				Role:      claims.Role,
+				SessionID: claims.SessionID,
+			})
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// AdminOnlyMiddleware ensures user has admin role
-func AdminOnlyMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		role := r.Header.Get("X-User-Role")
-		if role != "admin" {
+// RequirePermission ensures the authenticated user holds at least one of perms.
+// It must run after AuthMiddleware.
+func RequirePermission(perms ...auth.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.PrincipalFromRequest(r)
+			if !ok {
+				respondError(w, http.StatusUnauthorized, "Token tidak ditemukan")
+				return
+			}
+
+			for _, perm := range perms {
+				if principal.Can(perm) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
 			respondError(w, http.StatusForbidden, "Anda tidak memiliki akses ke resource ini")
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+		})
+	}
 }
 
 func extractToken(r *http.Request) string {
@@ -68,35 +103,42 @@ func extractToken(r *http.Request) string {
 	return r.URL.Query().Get("token")
 }
 
-func verifyToken(tokenString, secret string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secret), nil
-	})
-
-	if err != nil {
-		return nil, err
+func respondError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	response := models.GenericResponse{
+		Status:  "error",
+		Message: message,
 	}
+	// Simple JSON encoding without external libraries
+	fmt.Fprintf(w, `{"status":"%s","message":"%s"}`, response.Status, escapeJSON(response.Message))
+}
 
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
+// respondClientRejected writes a client policy rejection with its error code
+// so apps can tell "update required" apart from other failures
+func respondClientRejected(w http.ResponseWriter, err error) {
+	var coded *services.CodedError
+	if !errors.As(err, &coded) {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	return claims, nil
-}
+	statusCode := http.StatusForbidden
+	if coded.Code == services.ErrCodeUpdateRequired {
+		statusCode = http.StatusUpgradeRequired
+	}
 
-func respondError(w http.ResponseWriter, statusCode int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	response := models.GenericResponse{
 		Status:  "error",
-		Message: message,
+		Code:    coded.Code,
+		Message: coded.Message,
 	}
-	// Simple JSON encoding without external libraries
-	fmt.Fprintf(w, `{"status":"%s","message":"%s"}`, response.Status, escapeJSON(response.Message))
+	if len(coded.Details) > 0 {
+		response.Data = coded.Details
+	}
+	json.NewEncoder(w).Encode(response)
 }
 
 func escapeJSON(s string) string {
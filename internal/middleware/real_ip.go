@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies parses proxy addresses given as IPs or CIDR ranges
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", v)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			v = fmt.Sprintf("%s/%d", v, bits)
+		}
+
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", v)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// RealIP replaces r.RemoteAddr with the client address from X-Forwarded-For
+// or X-Real-IP, but only when the request comes from a trusted proxy. The
+// forwarded chain is read from the right, so addresses a client prepends
+// itself are never used. Headers from any other peer are ignored.
+func RealIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	isTrusted := func(ip net.IP) bool {
+		for _, network := range trusted {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer := net.ParseIP(remoteHost(r.RemoteAddr))
+			if len(trusted) == 0 || peer == nil || !isTrusted(peer) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := ""
+			if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+				hops := strings.Split(forwarded, ",")
+				for i := len(hops) - 1; i >= 0; i-- {
+					ip := net.ParseIP(strings.TrimSpace(hops[i]))
+					if ip == nil {
+						break
+					}
+					client = ip.String()
+					if !isTrusted(ip) {
+						break
+					}
+				}
+			} else if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+				client = ip.String()
+			}
+
+			if client != "" {
+				r.RemoteAddr = client
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// remoteHost strips the port from a RemoteAddr
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
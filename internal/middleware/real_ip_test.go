@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16", "::1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+	want := []string{"10.0.0.1/32", "192.168.0.0/16", "::1/128"}
+	for i, network := range proxies {
+		if network.String() != want[i] {
+			t.Errorf("proxy %d = %s, want %s", i, network, want[i])
+		}
+	}
+
+	for _, bad := range []string{"proxy.local", "10.0.0.1/33"} {
+		if _, err := ParseTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		trusted    bool
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"no proxies configured", false, "203.0.113.7:5000", "198.51.100.1", "", "203.0.113.7:5000"},
+		{"untrusted peer", true, "203.0.113.7:5000", "198.51.100.1", "198.51.100.2", "203.0.113.7:5000"},
+		{"trusted peer", true, "10.0.0.2:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed entry before client", true, "10.0.0.2:5000", "1.2.3.4, 198.51.100.1", "", "198.51.100.1"},
+		{"chain of proxies", true, "10.0.0.2:5000", "198.51.100.1, 10.0.0.3", "", "198.51.100.1"},
+		{"only proxies", true, "10.0.0.2:5000", "10.0.0.4, 10.0.0.3", "", "10.0.0.4"},
+		{"malformed entry", true, "10.0.0.2:5000", "garbage", "", "10.0.0.2:5000"},
+		{"x-real-ip", true, "10.0.0.2:5000", "", "198.51.100.1", "198.51.100.1"},
+		{"no headers", true, "10.0.0.2:5000", "", "", "10.0.0.2:5000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies := trusted
+			if !tt.trusted {
+				proxies = nil
+			}
+
+			var got string
+			h := RealIP(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
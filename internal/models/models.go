@@ -1,14 +1,17 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // User represents a system user (admin or petugas)
 type User struct {
-	ID           string     `json:"id"`           // USR-001
+	ID           string     `json:"id"` // USR-001
 	Name         string     `json:"name"`
-	Role         string     `json:"role"`         // admin or petugas
+	Role         string     `json:"role"` // admin or petugas
 	Username     string     `json:"username"`
-	PasswordHash string     `json:"-"`            // Never expose password hash
+	PasswordHash string     `json:"-"` // Never expose password hash
 	Token        string     `json:"token,omitempty"`
 	TokenExpiry  *time.Time `json:"token_expiry,omitempty"`
 	LastLogin    *time.Time `json:"last_login,omitempty"`
@@ -19,68 +22,443 @@ type User struct {
 
 // Customer represents a jimpitan member
 type Customer struct {
-	ID               string    `json:"id"`           // CUST-001
-	Blok             string    `json:"blok"`         // Block/ID number
-	Nama             string    `json:"nama"`         // Full name
-	QRHash           string    `json:"qr_hash"`      // 10-char QR identifier
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
-	TotalSetoran     float64   `json:"total_setoran"`
-	LastTransaction  *time.Time `json:"last_transaction,omitempty"`
-	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
-}
-
-// Transaction represents a jimpitan deposit
+	ID              string     `json:"id"`      // CUST-001
+	Blok            string     `json:"blok"`    // Block/ID number
+	Nama            string     `json:"nama"`    // Full name
+	QRHash          string     `json:"qr_hash"` // 10-char QR identifier
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	TotalSetoran    Money      `json:"total_setoran"`
+	LastTransaction *time.Time `json:"last_transaction,omitempty"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+}
+
+// CustomerSyncEntry is the compact customer record the mobile app caches
+// for offline QR lookup
+type CustomerSyncEntry struct {
+	ID     string `json:"id"`
+	Blok   string `json:"blok"`
+	Nama   string `json:"nama"`
+	QRHash string `json:"qr_hash"`
+}
+
+// CustomerSync is one page of customer directory changes since a cursor
+type CustomerSync struct {
+	Customers  []CustomerSyncEntry `json:"customers"`
+	Deleted    []string            `json:"deleted"` // IDs to drop from the local cache
+	NextCursor string              `json:"next_cursor"`
+	HasMore    bool                `json:"has_more"`
+}
+
+// Transaction represents a jimpitan deposit, or the reversal of one.
+// Cancelling adds a reversal row with the negated nominal; edits keep a
+// revision in transaction_revisions.
 type Transaction struct {
-	ID           string    `json:"id"`           // TXID
-	Timestamp    time.Time `json:"timestamp"`
-	CustomerID   string    `json:"customer_id"`  // Reference to Customer
-	Blok         string    `json:"blok"`
-	Nama         string    `json:"nama"`
-	Nominal      float64   `json:"nominal"`
-	UserID       string    `json:"user_id"`      // Reference to User
-	Petugas      string    `json:"petugas"`      // Staff name
-	CreatedAt    time.Time `json:"created_at"`
-	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	ID         string     `json:"id"` // TXID
+	Timestamp  time.Time  `json:"timestamp"`
+	CustomerID string     `json:"customer_id"` // Reference to Customer
+	Blok       string     `json:"blok"`
+	Nama       string     `json:"nama"`
+	Nominal    Money      `json:"nominal"`
+	UserID     string     `json:"user_id"` // Reference to User
+	Petugas    string     `json:"petugas"` // Staff name
+	Notes      *string    `json:"notes,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  *string    `json:"created_by,omitempty"`  // User who recorded the entry
+	ReversesID *string    `json:"reverses_id,omitempty"` // Set on a reversal: the entry it cancels
+	Reason     *string    `json:"reason,omitempty"`      // Why the original was reversed
+	ReversalID *string    `json:"reversal_id,omitempty"` // Set on a reversed entry: its reversal
+	ChainSeq   *int64     `json:"chain_seq,omitempty"`   // Position in the ledger hash chain
+	EntryHash  *string    `json:"entry_hash,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
+
+// SubmitTransactionRequest represents a new deposit. Blok, nama and the
+// collector are filled in by the server from the customer record and the
+// authenticated user.
+type SubmitTransactionRequest struct {
+	// Identify the customer by ID or by the scanned QR hash
+	CustomerID string `json:"customer_id,omitempty"`
+	QRHash     string `json:"qr_hash,omitempty"`
+	Nominal    Money  `json:"nominal"`
+	// Record the deposit for another collector (requires
+	// transactions.create.on_behalf; audited)
+	OnBehalfOf string `json:"on_behalf_of,omitempty"`
+	// Client-generated UUID, used as idempotency key when the
+	// Idempotency-Key header is absent
+	ClientRequestID string `json:"client_request_id,omitempty"`
+	// When the deposit was collected, for submissions queued offline.
+	// Defaults to the time the server receives it.
+	CapturedAt *time.Time `json:"captured_at,omitempty"`
+}
+
+// UpdateTransactionRequest corrects a deposit; omitted fields keep their value
+type UpdateTransactionRequest struct {
+	CustomerID *string `json:"customer_id"`
+	Nominal    *Money  `json:"nominal"`
+	Notes      *string `json:"notes"` // empty string clears the notes
+	Reason     string  `json:"reason"`
+}
+
+// TransactionRevision is one edit of a transaction, with the values before
+// and after it
+type TransactionRevision struct {
+	ID            int64     `json:"id"`
+	TransactionID string    `json:"transaction_id"`
+	OldCustomerID string    `json:"old_customer_id"`
+	NewCustomerID string    `json:"new_customer_id"`
+	OldBlok       string    `json:"old_blok"`
+	NewBlok       string    `json:"new_blok"`
+	OldNama       string    `json:"old_nama"`
+	NewNama       string    `json:"new_nama"`
+	OldNominal    Money     `json:"old_nominal"`
+	NewNominal    Money     `json:"new_nominal"`
+	OldNotes      *string   `json:"old_notes"`
+	NewNotes      *string   `json:"new_notes"`
+	Reason        string    `json:"reason"`
+	EditedBy      string    `json:"edited_by"`
+	CreatedAt     time.Time `json:"created_at"`
+	ChainSeq      *int64    `json:"chain_seq,omitempty"`
+	PrevHash      *string   `json:"-"`
+	EntryHash     *string   `json:"entry_hash,omitempty"`
+}
+
+// SyncTransactionsRequest uploads deposits queued offline by the mobile app.
+// Items stay raw so a malformed item is rejected on its own instead of
+// failing the whole batch.
+type SyncTransactionsRequest struct {
+	Transactions []json.RawMessage `json:"transactions"`
+}
+
+// Sync item statuses
+const (
+	SyncAccepted  = "accepted"
+	SyncDuplicate = "duplicate"
+	SyncRejected  = "rejected"
+)
+
+// SyncItemResult is the outcome of one uploaded deposit
+type SyncItemResult struct {
+	ClientRequestID string       `json:"client_request_id"`
+	Status          string       `json:"status"` // accepted, duplicate or rejected
+	Transaction     *Transaction `json:"transaction,omitempty"`
+	Code            string       `json:"code,omitempty"`
+	Error           string       `json:"error,omitempty"`
 }
 
 // Config represents system configuration
 type Config struct {
-	ID                  string    `json:"id"`
-	PetugasWebLoginEnabled bool   `json:"petugas_web_login_enabled"`
-	MobileAppVersion    string    `json:"mobile_app_version"`
-	UpdatedAt           time.Time `json:"updated_at"`
+	ID                     string        `json:"id"`
+	PetugasWebLoginEnabled bool          `json:"petugas_web_login_enabled"`
+	MobileAppVersion       string        `json:"mobile_app_version"`
+	ApprovalRules          ApprovalRules `json:"approval_rules"`
+	UpdatedAt              time.Time     `json:"updated_at"`
+}
+
+// ApprovalRules decide which operations need a second user's approval
+type ApprovalRules struct {
+	ReverseAfterHours int   `json:"reverse_after_hours"` // reversing an entry recorded longer ago; 0 disables
+	NominalThreshold  Money `json:"nominal_threshold"`   // reversing an entry of at least this nominal; 0 disables
+	BulkDelete        bool  `json:"bulk_delete"`         // bulk transaction reversals and user deletes
+	RoleChange        bool  `json:"role_change"`
+	ExpiryHours       int   `json:"expiry_hours"` // pending requests expire after this long
 }
 
-// Session represents an active user session
+// ConfigUpdateRequest changes system configuration; omitted fields keep their value
+type ConfigUpdateRequest struct {
+	PetugasWebLoginEnabled *bool                       `json:"petugas_web_login_enabled"`
+	MobileAppVersion       *string                     `json:"mobile_app_version"`
+	ApprovalRules          *ApprovalRulesUpdateRequest `json:"approval_rules"`
+}
+
+// ApprovalRulesUpdateRequest changes approval rules; omitted fields keep their value
+type ApprovalRulesUpdateRequest struct {
+	ReverseAfterHours *int   `json:"reverse_after_hours"`
+	NominalThreshold  *Money `json:"nominal_threshold"`
+	BulkDelete        *bool  `json:"bulk_delete"`
+	RoleChange        *bool  `json:"role_change"`
+	ExpiryHours       *int   `json:"expiry_hours"`
+}
+
+// Session represents an active user session (one per logged-in device)
 type Session struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Token      string     `json:"-"` // SHA-256 of the issued token
+	DeviceName string     `json:"device_name,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	IPAddress  string     `json:"ip_address,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Current    bool       `json:"current"`
+}
+
+// ClientInfo describes the device a request comes from
+type ClientInfo struct {
+	DeviceName string
+	UserAgent  string
+	IPAddress  string
+	ClientType string // web or mobile
+	AppVersion string // reported by mobile clients
 }
 
 // LoginRequest represents login credentials
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name,omitempty"`
 }
 
 // LoginResponse represents successful login response
 type LoginResponse struct {
-	ID          string     `json:"id"`
-	Name        string     `json:"name"`
-	Role        string     `json:"role"`
-	Username    string     `json:"username"`
-	Token       string     `json:"token"`
-	TokenExpiry *time.Time `json:"token_expiry"`
-	LastLogin   *time.Time `json:"last_login"`
+	ID                 string     `json:"id"`
+	Name               string     `json:"name"`
+	Role               string     `json:"role"`
+	Username           string     `json:"username"`
+	Token              string     `json:"token,omitempty"`
+	TokenExpiry        *time.Time `json:"token_expiry,omitempty"`
+	RefreshToken       string     `json:"refresh_token,omitempty"`
+	RefreshTokenExpiry *time.Time `json:"refresh_token_expiry,omitempty"`
+	SessionID          string     `json:"session_id,omitempty"`
+	LastLogin          *time.Time `json:"last_login"`
+
+	// Set instead of the tokens when a second login step is required
+	TwoFactor *TwoFactorChallenge `json:"two_factor,omitempty"`
+	// Returned once, right after two-factor enrollment completes
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// TwoFactorChallenge is a pending second login step
+type TwoFactorChallenge struct {
+	Token     string    `json:"challenge_token"`
+	Type      string    `json:"type"` // totp (enter code) or enroll (set up 2FA first)
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TwoFactorLoginRequest completes a login challenge
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code,omitempty"`
+	RecoveryCode   string `json:"recovery_code,omitempty"`
+	DeviceName     string `json:"device_name,omitempty"`
+}
+
+// TwoFactorSetup holds a new TOTP secret to add to an authenticator app
+type TwoFactorSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // render as QR code
+}
+
+// PasswordResetCode is a one-time code an admin hands to a user
+type PasswordResetCode struct {
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PasswordResetRequest redeems a reset code for a new password
+type PasswordResetRequest struct {
+	Username    string `json:"username"`
+	Code        string `json:"code"`
+	NewPassword string `json:"new_password"`
+}
+
+// RefreshTokenRequest represents a token refresh request
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ReportSummary represents deposit totals for a date range
+type ReportSummary struct {
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Total     Money         `json:"total"`
+	Count     int           `json:"count"`
+	ByBlok    []ReportGroup `json:"by_blok"`
+	ByPetugas []ReportGroup `json:"by_petugas"`
+}
+
+// ReportGroup represents the totals of one group in a report
+type ReportGroup struct {
+	Key   string `json:"key"`   // blok or user ID
+	Label string `json:"label"` // blok or petugas name
+	Total Money  `json:"total"`
+	Count int    `json:"count"`
+}
+
+// BalanceMismatch is a customer whose cached aggregates disagree with the
+// transactions ledger
+type BalanceMismatch struct {
+	CustomerID              string     `json:"customer_id"`
+	Nama                    string     `json:"nama"`
+	StoredTotal             Money      `json:"stored_total"`
+	ExpectedTotal           Money      `json:"expected_total"`
+	StoredLastTransaction   *time.Time `json:"stored_last_transaction"`
+	ExpectedLastTransaction *time.Time `json:"expected_last_transaction"`
+	Fixed                   bool       `json:"fixed"`
+}
+
+// ReconcileReport is the result of one reconciliation run
+type ReconcileReport struct {
+	CheckedAt  time.Time         `json:"checked_at"`
+	Checked    int               `json:"checked"`
+	Mismatches []BalanceMismatch `json:"mismatches"`
+	Fixed      int               `json:"fixed"`
+}
+
+// AuditLogEntry is one recorded change. Before and After are JSON snapshots
+// of the entity.
+type AuditLogEntry struct {
+	ID         int64           `json:"id"`
+	ActorID    *string         `json:"actor_id"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	IPAddress  *string         `json:"ip_address,omitempty"`
+	UserAgent  *string         `json:"user_agent,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditLogFilter narrows an audit log query; empty fields match everything
+type AuditLogFilter struct {
+	ActorID    string
+	Action     string
+	EntityType string
+	EntityID   string
+	From       *time.Time
+	To         *time.Time
+	BeforeID   int64
+	Limit      int
+}
+
+// AuditLogPage is one page of audit entries, newest first
+type AuditLogPage struct {
+	Entries      []AuditLogEntry `json:"entries"`
+	NextBeforeID int64           `json:"next_before_id,omitempty"` // 0 when there are no older entries
+}
+
+// ApprovalRequest is a sensitive operation waiting for, or decided by, a
+// second user. Payload holds the operation's arguments.
+type ApprovalRequest struct {
+	ID           int64           `json:"id"`
+	Action       string          `json:"action"`
+	Rule         string          `json:"rule"`
+	Summary      string          `json:"summary"`
+	Payload      json.RawMessage `json:"payload"`
+	Status       string          `json:"status"`
+	RequestedBy  string          `json:"requested_by"`
+	DecidedBy    *string         `json:"decided_by,omitempty"`
+	DecisionNote *string         `json:"decision_note,omitempty"`
+	Result       json.RawMessage `json:"result,omitempty"` // outcome of the executed operation
+	Error        *string         `json:"error,omitempty"`  // why an approved operation failed
+	CreatedAt    time.Time       `json:"created_at"`
+	ExpiresAt    time.Time       `json:"expires_at"`
+	DecidedAt    *time.Time      `json:"decided_at,omitempty"`
+}
+
+// secretPayloadFields are payload fields kept in the database for execution
+// but never encoded into responses or audit snapshots
+var secretPayloadFields = []string{"password_hash"}
+
+// MarshalJSON encodes the request with secret payload fields removed
+func (r ApprovalRequest) MarshalJSON() ([]byte, error) {
+	type plain ApprovalRequest
+	out := plain(r)
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(r.Payload, &fields) == nil {
+		redacted := false
+		for _, name := range secretPayloadFields {
+			if _, ok := fields[name]; ok {
+				delete(fields, name)
+				redacted = true
+			}
+		}
+		if redacted {
+			payload, err := json.Marshal(fields)
+			if err != nil {
+				return nil, err
+			}
+			out.Payload = payload
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// Approval request statuses
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+	ApprovalFailed   = "failed" // approved, but the operation could not be executed
+)
+
+// AccountingPeriod is a month that was closed. Transactions dated in a
+// closed period cannot be added, edited, reversed or restored.
+type AccountingPeriod struct {
+	Period       string          `json:"period"` // YYYY-MM
+	Status       string          `json:"status"`
+	Snapshot     *PeriodSnapshot `json:"snapshot"` // taken at the last close
+	ClosedBy     string          `json:"closed_by"`
+	ClosedAt     time.Time       `json:"closed_at"`
+	ReopenedBy   *string         `json:"reopened_by,omitempty"`
+	ReopenedAt   *time.Time      `json:"reopened_at,omitempty"`
+	ReopenReason *string         `json:"reopen_reason,omitempty"`
+}
+
+// PeriodSnapshot is the period's report at closing, with the ledger chain
+// head at the end of the month
+type PeriodSnapshot struct {
+	ReportSummary
+	ChainSeq  int64  `json:"chain_seq"`
+	ChainHash string `json:"chain_hash"`
+}
+
+// Accounting period statuses
+const (
+	PeriodClosed   = "closed"
+	PeriodReopened = "reopened"
+)
+
+// ChainVerification is the result of walking the ledger hash chain
+type ChainVerification struct {
+	Valid     bool        `json:"valid"`
+	Checked   int         `json:"checked"` // entries verified before the first break
+	HeadSeq   int64       `json:"head_seq"`
+	HeadHash  string      `json:"head_hash"`
+	Broken    *ChainBreak `json:"broken,omitempty"`
+	CheckedAt time.Time   `json:"checked_at"`
+}
+
+// ChainBreak is the first broken link found in the chain
+type ChainBreak struct {
+	Seq    int64  `json:"seq,omitempty"`
+	Kind   string `json:"kind,omitempty"` // transaction or revision
+	ID     string `json:"id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ChainHead is the last chain entry recorded before Until, published at
+// month end so anyone can later check the ledger was not rewritten
+type ChainHead struct {
+	Month        string    `json:"month,omitempty"`
+	Until        time.Time `json:"until"`
+	Seq          int64     `json:"seq"`
+	Hash         string    `json:"hash"`
+	Transactions int       `json:"transactions"`
+	Total        Money     `json:"total"`
 }
 
 // GenericResponse represents standard API response
 type GenericResponse struct {
-	Status  string      `json:"status"`  // success or error
+	Status  string      `json:"status"`         // success or error
+	Code    string      `json:"code,omitempty"` // machine-readable error code
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
 }
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestApprovalRequestRedactsSecrets(t *testing.T) {
+	request := ApprovalRequest{
+		ID:      1,
+		Action:  "user.create",
+		Payload: json.RawMessage(`{"username":"ketua","role":"ketua_rt","password_hash":"$argon2id$secret"}`),
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "password_hash") || strings.Contains(string(data), "argon2id") {
+		t.Errorf("encoded request leaks the password hash: %s", data)
+	}
+
+	var decoded struct {
+		Payload map[string]string `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Payload["username"] != "ketua" || decoded.Payload["role"] != "ketua_rt" {
+		t.Errorf("payload = %v, want other fields kept", decoded.Payload)
+	}
+
+	// The stored payload is left intact for execution
+	if !strings.Contains(string(request.Payload), "password_hash") {
+		t.Error("MarshalJSON modified the request")
+	}
+}
+
+func TestApprovalRequestWithoutSecrets(t *testing.T) {
+	for _, payload := range []string{`{"ids":["USR-002"]}`, `["not","an","object"]`} {
+		data, err := json.Marshal(ApprovalRequest{Payload: json.RawMessage(payload)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `"payload":`+payload) {
+			t.Errorf("payload %s not encoded as is: %s", payload, data)
+		}
+	}
+}
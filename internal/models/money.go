@@ -0,0 +1,159 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact rupiah amount counted in sen (1/100 rupiah), matching
+// the DECIMAL(12,2) columns. It never passes through float64, so sums and
+// JSON round-trips do not drift.
+type Money int64
+
+// MaxMoney is the largest amount a DECIMAL(12,2) column can hold
+const MaxMoney Money = 999999999999
+
+// MoneyError reports an amount that is not a valid rupiah value
+type MoneyError struct {
+	Input  string
+	Reason string
+}
+
+func (e *MoneyError) Error() string {
+	return fmt.Sprintf("nominal %q %s", e.Input, e.Reason)
+}
+
+// ParseMoney parses a decimal rupiah amount such as "1500", "1500.5" or
+// "-20.25". More than two decimal places, exponents and amounts beyond
+// MaxMoney are rejected.
+func ParseMoney(s string) (Money, error) {
+	sen, err := parseSen(strings.TrimSpace(s))
+	if err != nil {
+		return 0, &MoneyError{Input: s, Reason: err.Error()}
+	}
+
+	m := Money(sen)
+	if m > MaxMoney || m < -MaxMoney {
+		return 0, &MoneyError{Input: s, Reason: "terlalu besar"}
+	}
+	return m, nil
+}
+
+// parseSen converts a plain decimal string with at most two decimals to sen
+func parseSen(s string) (int64, error) {
+	negative := strings.HasPrefix(s, "-")
+	if negative {
+		s = s[1:]
+	}
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" || (hasFrac && frac == "") || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("bukan angka yang valid")
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("maksimal 2 angka desimal")
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	sen, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("terlalu besar")
+	}
+	if negative {
+		sen = -sen
+	}
+	return sen, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the amount as a plain decimal: "1500" for whole rupiah,
+// otherwise with two decimals ("1500.50")
+func (m Money) String() string {
+	sign, v := "", int64(m)
+	if v < 0 {
+		sign, v = "-", -v
+	}
+
+	if v%100 == 0 {
+		return fmt.Sprintf("%s%d", sign, v/100)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// MarshalJSON encodes the amount as an exact JSON number
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or numeric string. Numbers are parsed
+// from their literal text, never via float64.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+
+	parsed, err := ParseMoney(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a DECIMAL column or aggregate
+func (m *Money) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		*m = Money(v * 100)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", value)
+	}
+
+	// SUM() and friends may report more scale than the column; anything
+	// past sen must be zero
+	if whole, frac, ok := strings.Cut(s, "."); ok && len(frac) > 2 {
+		if strings.Trim(frac[2:], "0") != "" {
+			return fmt.Errorf("cannot scan %q into Money: sub-sen precision", s)
+		}
+		s = whole + "." + frac[:2]
+	}
+
+	// No MaxMoney check: sums may exceed what a single column holds
+	sen, err := parseSen(s)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money: %v", s, err)
+	}
+	*m = Money(sen)
+	return nil
+}
+
+// Value writes the amount as an exact decimal string
+func (m Money) Value() (driver.Value, error) {
+	sign, v := "", int64(m)
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100), nil
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{"0", 0},
+		{"1500", 150000},
+		{"1500.5", 150050},
+		{"1500.05", 150005},
+		{"-20.25", -2025},
+		{" 42 ", 4200},
+		{"0.01", 1},
+		{"9999999999.99", MaxMoney},
+		{"-9999999999.99", -MaxMoney},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if err != nil {
+			t.Errorf("ParseMoney(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseMoneyRejects(t *testing.T) {
+	for _, in := range []string{
+		"", "-", ".5", "5.", "1.234", "1e3", "+5", "--5", "1,5", "abc",
+		"10000000000", "-10000000000", "99999999999999999999",
+	} {
+		_, err := ParseMoney(in)
+		var moneyErr *MoneyError
+		if !errors.As(err, &moneyErr) {
+			t.Errorf("ParseMoney(%q) error = %v, want *MoneyError", in, err)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0"},
+		{150000, "1500"},
+		{150050, "1500.50"},
+		{150005, "1500.05"},
+		{-2025, "-20.25"},
+		{-100, "-1"},
+		{1, "0.01"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var v struct {
+		A Money `json:"a"`
+		B Money `json:"b"`
+	}
+	if err := json.Unmarshal([]byte(`{"a": 0.1, "b": "2500.75"}`), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if v.A != 10 || v.B != 250075 {
+		t.Fatalf("got a=%d b=%d, want a=10 b=250075", v.A, v.B)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(data) != `{"a":0.10,"b":2500.75}` {
+		t.Errorf("Marshal = %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"a": 1.005}`), &v); err == nil {
+		t.Error("Unmarshal accepted sub-sen precision")
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want Money
+	}{
+		{nil, 0},
+		{[]byte("1500.50"), 150050},
+		{"-20.2500", -2025},
+		{int64(7), 700},
+		{[]byte("123456789012345.00"), 12345678901234500}, // sums may exceed MaxMoney
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := m.Scan(tt.in); err != nil {
+			t.Errorf("Scan(%v): %v", tt.in, err)
+			continue
+		}
+		if m != tt.want {
+			t.Errorf("Scan(%v) = %d, want %d", tt.in, m, tt.want)
+		}
+	}
+
+	var m Money
+	if err := m.Scan("1.001"); err == nil {
+		t.Error("Scan accepted sub-sen precision")
+	}
+	if err := m.Scan(1.5); err == nil {
+		t.Error("Scan accepted float64")
+	}
+}
+
+func TestMoneyValue(t *testing.T) {
+	for in, want := range map[Money]string{0: "0.00", 150050: "1500.50", -2025: "-20.25"} {
+		got, err := in.Value()
+		if err != nil || got != want {
+			t.Errorf("Money(%d).Value() = %v, %v, want %q", in, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"jimpitan/backend/internal/auth"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions that may need approval
+const (
+	ApprovalReverseTransaction = "transaction.reverse"
+	ApprovalBulkReverse        = "transaction.bulk_reverse"
+	ApprovalUpdateTransaction  = "transaction.update"
+	ApprovalCreateUser         = "user.create"
+	ApprovalBulkDeleteUsers    = "user.bulk_delete"
+	ApprovalRoleChange         = "user.role_change"
+	ApprovalReopenPeriod       = "period.reopen"
+	ApprovalUpdateConfig       = "config.update"
+)
+
+// Rules that put an action up for approval, named after their config field
+const (
+	RuleReverseAge    = "reverse_after_hours"
+	RuleNominal       = "nominal_threshold"
+	RuleBulkDelete    = "bulk_delete"
+	RuleRoleChange    = "role_change"   // also creating a user with a privileged role
+	RuleReopenPeriod  = "period_reopen" // always required
+	RuleExpiry        = "expiry_hours"
+	RuleApprovalRules = "approval_rules" // relaxing any rule above
+)
+
+const maxApprovalListSize = 200
+
+// ApprovalExecutor runs an approved action with the payload it was
+// requested with, on behalf of the requester
+type ApprovalExecutor func(payload json.RawMessage, requester *auth.Principal, actor Actor) (interface{}, error)
+
+type approvalAction struct {
+	execute ApprovalExecutor
+	perms   []auth.Permission
+	// approver, if set, is required on top of approvals.decide to decide
+	approver auth.Permission
+}
+
+type ApprovalService struct {
+	db      *database.DB
+	config  *ConfigService
+	audit   *AuditService
+	actions map[string]approvalAction
+}
+
+func NewApprovalService(db *database.DB, config *ConfigService, audit *AuditService) *ApprovalService {
+	return &ApprovalService{db: db, config: config, audit: audit, actions: map[string]approvalAction{}}
+}
+
+// Register sets how an approved action is executed. The requester must
+// still hold one of perms when it is approved.
+func (s *ApprovalService) Register(action string, execute ApprovalExecutor, perms ...auth.Permission) {
+	s.actions[action] = approvalAction{execute: execute, perms: perms}
+}
+
+// RequireApprover restricts deciding requests for a registered action to
+// users who also hold perm
+func (s *ApprovalService) RequireApprover(action string, perm auth.Permission) {
+	a := s.actions[action]
+	a.approver = perm
+	s.actions[action] = a
+}
+
+// Rules returns the approval rules currently configured
+func (s *ApprovalService) Rules() (models.ApprovalRules, error) {
+	cfg, err := s.config.GetConfig()
+	if err != nil {
+		return models.ApprovalRules{}, err
+	}
+	return cfg.ApprovalRules, nil
+}
+
+// ReversalRule returns the rule that makes reversing t need approval, or ""
+func ReversalRule(rules models.ApprovalRules, t *models.Transaction) string {
+	if rules.ReverseAfterHours > 0 && time.Since(t.CreatedAt) > time.Duration(rules.ReverseAfterHours)*time.Hour {
+		return RuleReverseAge
+	}
+
+	nominal := t.Nominal
+	if nominal < 0 {
+		nominal = -nominal
+	}
+	if rules.NominalThreshold > 0 && nominal >= rules.NominalThreshold {
+		return RuleNominal
+	}
+
+	return ""
+}
+
+// Request stores action as a pending request instead of executing it. The
+// returned APPROVAL_REQUIRED error carries the request and should be passed
+// back to the client as is.
+func (s *ApprovalService) Request(action, rule, summary string, payload interface{}, actor Actor) error {
+	request, err := s.Submit(action, rule, summary, payload, actor)
+	if err != nil {
+		return err
+	}
+	return approvalRequired(request)
+}
+
+// approvalRequired is the APPROVAL_REQUIRED error for a queued request
+func approvalRequired(request *models.ApprovalRequest) error {
+	return &CodedError{
+		Code:    ErrCodeApprovalRequired,
+		Message: PendingMessage(request),
+		Details: map[string]interface{}{"approval_request": request},
+	}
+}
+
+// PendingMessage tells the requester that request awaits approval
+func PendingMessage(request *models.ApprovalRequest) string {
+	return fmt.Sprintf("Tindakan ini memerlukan persetujuan user lain, permintaan #%d menunggu persetujuan", request.ID)
+}
+
+// Submit stores action as a pending request and returns it, for operations
+// that always need approval
+func (s *ApprovalService) Submit(action, rule, summary string, payload interface{}, actor Actor) (*models.ApprovalRequest, error) {
+	if actor.UserID == "" {
+		return nil, fmt.Errorf("permintaan persetujuan memerlukan user yang login")
+	}
+
+	rules, err := s.Rules()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode approval payload: %w", err)
+	}
+
+	now := time.Now()
+	request := &models.ApprovalRequest{
+		Action:      action,
+		Rule:        rule,
+		Summary:     truncate(summary, 255),
+		Payload:     data,
+		Status:      models.ApprovalPending,
+		RequestedBy: actor.UserID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Duration(rules.ExpiryHours) * time.Hour),
+	}
+
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(
+			`INSERT INTO approval_requests (action, rule, summary, payload, status, requested_by, created_at, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			request.Action, request.Rule, request.Summary, string(request.Payload), request.Status,
+			request.RequestedBy, request.CreatedAt, request.ExpiresAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create approval request: %w", err)
+		}
+		if request.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditCreate,
+			EntityType: EntityApproval,
+			EntityID:   strconv.FormatInt(request.ID, 10),
+			After:      request,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+const approvalColumns = "id, action, rule, summary, payload, status, requested_by, decided_by, decision_note, result, error, created_at, expires_at, decided_at"
+
+func scanApproval(row interface{ Scan(...interface{}) error }, r *models.ApprovalRequest) error {
+	var payload string
+	var result sql.NullString
+	err := row.Scan(&r.ID, &r.Action, &r.Rule, &r.Summary, &payload, &r.Status, &r.RequestedBy, &r.DecidedBy,
+		&r.DecisionNote, &result, &r.Error, &r.CreatedAt, &r.ExpiresAt, &r.DecidedAt)
+	if err != nil {
+		return err
+	}
+
+	r.Payload = json.RawMessage(payload)
+	if result.Valid {
+		r.Result = json.RawMessage(result.String)
+	}
+	return nil
+}
+
+// List returns approval requests, newest first, optionally only those with
+// status. Without approvals.decide, principal only sees their own requests.
+func (s *ApprovalService) List(status string, principal *auth.Principal) ([]models.ApprovalRequest, error) {
+	if err := s.expireDue(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + approvalColumns + " FROM approval_requests WHERE 1 = 1"
+	args := []interface{}{}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if !principal.Can(auth.PermApprovalsDecide) {
+		query += " AND requested_by = ?"
+		args = append(args, principal.UserID)
+	}
+	query += " ORDER BY id DESC LIMIT " + strconv.Itoa(maxApprovalListSize)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query approval requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []models.ApprovalRequest{}
+	for rows.Next() {
+		var r models.ApprovalRequest
+		if err := scanApproval(rows, &r); err != nil {
+			return nil, fmt.Errorf("failed to scan approval request: %w", err)
+		}
+		requests = append(requests, r)
+	}
+
+	return requests, rows.Err()
+}
+
+// expireDue marks pending requests past their expiry as expired
+func (s *ApprovalService) expireDue() error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		rows, err := tx.Query(
+			"SELECT "+approvalColumns+" FROM approval_requests WHERE status = ? AND expires_at <= ? FOR UPDATE",
+			models.ApprovalPending, time.Now(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to query expired approval requests: %w", err)
+		}
+		var due []models.ApprovalRequest
+		for rows.Next() {
+			var r models.ApprovalRequest
+			if err := scanApproval(rows, &r); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan approval request: %w", err)
+			}
+			due = append(due, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i := range due {
+			if err := s.expireTx(tx, &due[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *ApprovalService) expireTx(tx *sql.Tx, r *models.ApprovalRequest) error {
+	before := *r
+	r.Status = models.ApprovalExpired
+	if _, err := tx.Exec("UPDATE approval_requests SET status = ? WHERE id = ?", r.Status, r.ID); err != nil {
+		return fmt.Errorf("failed to expire approval request: %w", err)
+	}
+
+	// Expiry is a system change, recorded without an actor
+	return s.audit.RecordTx(tx, Actor{}, AuditEntry{
+		Action:     AuditExpire,
+		EntityType: EntityApproval,
+		EntityID:   strconv.FormatInt(r.ID, 10),
+		Before:     &before,
+		After:      r,
+	})
+}
+
+// Approve approves a pending request and executes its action as the
+// requester. The decision is committed before the action runs; if the action
+// fails the request ends up failed with the error, and nothing is retried.
+func (s *ApprovalService) Approve(id int64, note string, principal *auth.Principal, actor Actor) (*models.ApprovalRequest, error) {
+	request, err := s.decide(id, models.ApprovalApproved, note, principal, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	result, execErr := s.execute(request, actor)
+
+	before := *request
+	if execErr != nil {
+		message := truncate(execErr.Error(), 255)
+		request.Status, request.Error = models.ApprovalFailed, &message
+	} else if result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode approval result: %w", err)
+		}
+		request.Result = data
+	}
+
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		var resultJSON interface{}
+		if request.Result != nil {
+			resultJSON = string(request.Result)
+		}
+		_, err := tx.Exec(
+			"UPDATE approval_requests SET status = ?, result = ?, error = ? WHERE id = ?",
+			request.Status, resultJSON, request.Error, request.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update approval request: %w", err)
+		}
+
+		if execErr == nil {
+			return nil
+		}
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditUpdate,
+			EntityType: EntityApproval,
+			EntityID:   strconv.FormatInt(request.ID, 10),
+			Before:     &before,
+			After:      request,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if execErr != nil {
+		return nil, &CodedError{
+			Code:    ErrCodeApprovalFailed,
+			Message: fmt.Sprintf("Permintaan #%d disetujui tetapi gagal dijalankan: %s", request.ID, execErr.Error()),
+			Details: map[string]interface{}{"approval_request": request},
+		}
+	}
+	return request, nil
+}
+
+// execute runs an approved request's action as its requester, who must still
+// be active and hold the action's permission
+func (s *ApprovalService) execute(request *models.ApprovalRequest, actor Actor) (interface{}, error) {
+	action, ok := s.actions[request.Action]
+	if !ok {
+		return nil, fmt.Errorf("aksi %s tidak dikenal", request.Action)
+	}
+
+	requester := &auth.Principal{UserID: request.RequestedBy}
+	err := s.db.QueryRow("SELECT role FROM users WHERE id = ? AND deleted_at IS NULL", request.RequestedBy).Scan(&requester.Role)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("pemohon sudah tidak aktif")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	allowed := len(action.perms) == 0
+	for _, perm := range action.perms {
+		allowed = allowed || requester.Can(perm)
+	}
+	if !allowed {
+		return nil, fmt.Errorf("pemohon tidak lagi memiliki izin untuk tindakan ini")
+	}
+
+	return action.execute(request.Payload, requester, actor)
+}
+
+// Reject rejects a pending request; note is the required reason
+func (s *ApprovalService) Reject(id int64, note string, principal *auth.Principal, actor Actor) (*models.ApprovalRequest, error) {
+	if strings.TrimSpace(note) == "" {
+		return nil, fmt.Errorf("alasan penolakan wajib diisi")
+	}
+	return s.decide(id, models.ApprovalRejected, note, principal, actor)
+}
+
+// decide records the decision on a pending request. Requests past their
+// expiry are expired instead, and nobody may decide their own request.
+func (s *ApprovalService) decide(id int64, status, note string, principal *auth.Principal, actor Actor) (*models.ApprovalRequest, error) {
+	note = strings.TrimSpace(note)
+	if len(note) > 255 {
+		return nil, fmt.Errorf("catatan maksimal 255 karakter")
+	}
+
+	var request models.ApprovalRequest
+	var expired bool
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		err := scanApproval(tx.QueryRow("SELECT "+approvalColumns+" FROM approval_requests WHERE id = ? FOR UPDATE", id), &request)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("permintaan persetujuan tidak ditemukan")
+		}
+		if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		if request.Status != models.ApprovalPending {
+			return fmt.Errorf("permintaan sudah diputuskan (status: %s)", request.Status)
+		}
+		if !request.ExpiresAt.After(time.Now()) {
+			expired = true
+			return s.expireTx(tx, &request)
+		}
+		if err := s.checkDecider(&request, principal); err != nil {
+			return err
+		}
+
+		before := request
+		now := time.Now()
+		request.Status = status
+		request.DecidedBy = &principal.UserID
+		request.DecisionNote = nullableString(note)
+		request.DecidedAt = &now
+
+		_, err = tx.Exec(
+			"UPDATE approval_requests SET status = ?, decided_by = ?, decision_note = ?, decided_at = ? WHERE id = ?",
+			request.Status, request.DecidedBy, request.DecisionNote, request.DecidedAt, request.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update approval request: %w", err)
+		}
+
+		action := AuditApprove
+		if status == models.ApprovalRejected {
+			action = AuditReject
+		}
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     action,
+			EntityType: EntityApproval,
+			EntityID:   strconv.FormatInt(request.ID, 10),
+			Before:     &before,
+			After:      &request,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, fmt.Errorf("permintaan sudah kedaluwarsa")
+	}
+
+	return &request, nil
+}
+
+// checkDecider rejects principal deciding request if they made it or lack
+// the approver permission of its action
+func (s *ApprovalService) checkDecider(request *models.ApprovalRequest, principal *auth.Principal) error {
+	if request.RequestedBy == principal.UserID {
+		return fmt.Errorf("anda tidak dapat memutuskan permintaan anda sendiri")
+	}
+	if approver := s.actions[request.Action].approver; approver != "" && !principal.Can(approver) {
+		return fmt.Errorf("permintaan ini hanya dapat diputuskan oleh user dengan izin %s", approver)
+	}
+	return nil
+}
+
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"jimpitan/backend/internal/models"
+	"testing"
+	"time"
+)
+
+func TestReversalRule(t *testing.T) {
+	rules := models.ApprovalRules{ReverseAfterHours: 24, NominalThreshold: 10000000} // 100000 rupiah
+
+	tests := []struct {
+		name    string
+		age     time.Duration
+		nominal models.Money
+		want    string
+	}{
+		{"recent and small", time.Hour, 500000, ""},
+		{"older than the window", 25 * time.Hour, 500000, RuleReverseAge},
+		{"at the threshold", time.Hour, 10000000, RuleNominal},
+		{"negative at the threshold", time.Hour, -10000000, RuleNominal},
+		{"just below the threshold", time.Hour, 9999999, ""},
+		{"old and large reports the age rule", 48 * time.Hour, 20000000, RuleReverseAge},
+	}
+	for _, tt := range tests {
+		tx := &models.Transaction{Nominal: tt.nominal, CreatedAt: time.Now().Add(-tt.age)}
+		if got := ReversalRule(rules, tx); got != tt.want {
+			t.Errorf("%s: ReversalRule = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	old := &models.Transaction{Nominal: 50000000, CreatedAt: time.Now().Add(-1000 * time.Hour)}
+	if got := ReversalRule(models.ApprovalRules{}, old); got != "" {
+		t.Errorf("disabled rules: ReversalRule = %q, want none", got)
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/models"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditCreate         = "create"
+	AuditUpdate         = "update"
+	AuditDelete         = "delete"
+	AuditRestore        = "restore"
+	AuditReverse        = "reverse"
+	AuditPasswordChange = "password_change"
+	AuditLogin          = "login"
+	AuditLogout         = "logout"
+	AuditApprove        = "approve"
+	AuditReject         = "reject"
+	AuditExpire         = "expire"
+	AuditClose          = "close"
+	AuditReopen         = "reopen"
+	AuditResetCodeIssue = "reset_code_issue"
+	AuditPasswordReset  = "password_reset"
+	AuditUnlock         = "unlock"
+	AuditTwoFactorOn    = "2fa_enable"
+	AuditTwoFactorOff   = "2fa_disable"
+	AuditRecoveryCodes  = "recovery_codes_regenerate"
+)
+
+// Audited entity types
+const (
+	EntityUser        = "user"
+	EntityCustomer    = "customer"
+	EntityTransaction = "transaction"
+	EntityApproval    = "approval_request"
+	EntityPeriod      = "period"
+	EntityConfig      = "config"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 500
+)
+
+// Actor identifies who makes a change and from where
+type Actor struct {
+	UserID    string
+	IPAddress string
+	UserAgent string
+}
+
+// AuditEntry describes one change. Before and After are snapshots of the
+// entity, stored as JSON; either may be nil.
+type AuditEntry struct {
+	Action     string
+	EntityType string
+	EntityID   string
+	Before     interface{}
+	After      interface{}
+}
+
+type AuditService struct {
+	db *database.DB
+}
+
+func NewAuditService(db *database.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record stores an audit entry on its own
+func (s *AuditService) Record(actor Actor, entry AuditEntry) error {
+	return s.RecordTx(s.db, actor, entry)
+}
+
+// RecordTx stores an audit entry through exec, typically the *sql.Tx of the
+// change so the entry commits or rolls back with it
+func (s *AuditService) RecordTx(exec database.Execer, actor Actor, entry AuditEntry) error {
+	before, err := auditSnapshot(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := auditSnapshot(entry.After)
+	if err != nil {
+		return err
+	}
+
+	_, err = exec.Exec(
+		`INSERT INTO audit_log (actor_id, action, entity_type, entity_id, before_json, after_json, ip_address, user_agent, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nullString(actor.UserID), entry.Action, entry.EntityType, entry.EntityID, before, after,
+		nullString(actor.IPAddress), nullString(truncate(actor.UserAgent, 255)), time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record audit log: %w", err)
+	}
+	return nil
+}
+
+func auditSnapshot(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit snapshot: %w", err)
+	}
+	if string(data) == "null" {
+		return nil, nil
+	}
+	return string(data), nil
+}
+
+// Query returns audit entries matching filter, newest first. Pages are
+// chained with BeforeID: pass the returned NextBeforeID to get older entries.
+func (s *AuditService) Query(filter models.AuditLogFilter) (*models.AuditLogPage, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditPageSize
+	}
+	if limit > maxAuditPageSize {
+		limit = maxAuditPageSize
+	}
+
+	query := "SELECT id, actor_id, action, entity_type, entity_id, before_json, after_json, ip_address, user_agent, created_at FROM audit_log WHERE 1 = 1"
+	args := []interface{}{}
+
+	conditions := []struct {
+		column string
+		value  string
+	}{
+		{"actor_id", filter.ActorID},
+		{"action", filter.Action},
+		{"entity_type", filter.EntityType},
+		{"entity_id", filter.EntityID},
+	}
+	for _, c := range conditions {
+		if c.value != "" {
+			query += " AND " + c.column + " = ?"
+			args = append(args, c.value)
+		}
+	}
+	if filter.From != nil {
+		query += " AND created_at >= ?"
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		query += " AND created_at < ?"
+		args = append(args, *filter.To)
+	}
+	if filter.BeforeID > 0 {
+		query += " AND id < ?"
+		args = append(args, filter.BeforeID)
+	}
+
+	// Fetch one extra row to know whether an older page exists
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.AuditLogPage{Entries: []models.AuditLogEntry{}}
+	for rows.Next() {
+		var e models.AuditLogEntry
+		var before, after []byte
+		err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.EntityType, &e.EntityID, &before, &after, &e.IPAddress, &e.UserAgent, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit log: %w", err)
+		}
+		if before != nil {
+			e.Before = json.RawMessage(before)
+		}
+		if after != nil {
+			e.After = json.RawMessage(after)
+		}
+		page.Entries = append(page.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Entries) > limit {
+		page.Entries = page.Entries[:limit]
+		page.NextBeforeID = page.Entries[limit-1].ID
+	}
+
+	return page, nil
+}
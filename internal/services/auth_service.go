@@ -3,44 +3,69 @@ package services
 import (
 	"database/sql"
 	"fmt"
+	"jimpitan/backend/internal/auth"
+	"jimpitan/backend/internal/config"
 	"jimpitan/backend/internal/database"
 	"jimpitan/backend/internal/models"
 	"jimpitan/backend/internal/utils"
+	"log"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type AuthService struct {
-	db        *database.DB
-	jwtSecret string
-	jwtExpiry int
+	db            *database.DB
+	sessions      *SessionService
+	throttle      *LoginThrottleService
+	twoFactor     *TwoFactorService
+	clients       *ConfigService
+	audit         *AuditService
+	jwtSecret     string
+	accessExpiry  time.Duration
+	refreshExpiry time.Duration
 }
 
-func NewAuthService(db *database.DB, jwtSecret string, expiryHours int) *AuthService {
+func NewAuthService(db *database.DB, sessions *SessionService, throttle *LoginThrottleService, twoFactor *TwoFactorService, clients *ConfigService, audit *AuditService, cfg *config.JWTConfig) *AuthService {
 	return &AuthService{
-		db:        db,
-		jwtSecret: jwtSecret,
-		jwtExpiry: expiryHours,
+		db:            db,
+		sessions:      sessions,
+		throttle:      throttle,
+		twoFactor:     twoFactor,
+		clients:       clients,
+		audit:         audit,
+		jwtSecret:     cfg.Secret,
+		accessExpiry:  time.Minute * time.Duration(cfg.AccessExpiryMinutes),
+		refreshExpiry: time.Hour * time.Duration(cfg.RefreshExpiryHours),
 	}
 }
 
-// Login authenticates user and returns token
-func (s *AuthService) Login(username, password string) (*models.LoginResponse, error) {
+// Login authenticates user and opens a new session for the client device.
+// When the user has (or by policy must set up) two-factor authentication,
+// no token is issued; the response carries a challenge to complete with
+// CompleteTwoFactor instead.
+func (s *AuthService) Login(username, password string, client models.ClientInfo) (*models.LoginResponse, error) {
 	if username == "" || password == "" {
 		return nil, fmt.Errorf("username dan password harus diisi")
 	}
 
+	// Refuse early while the account or IP is locked out
+	if err := s.throttle.Check(username, client.IPAddress); err != nil {
+		return nil, err
+	}
+
 	var user models.User
 	var dbPasswordHash string
+	var tokenVersion int
+	var totpEnabled bool
 
 	err := s.db.QueryRow(
-		"SELECT id, name, role, username, password_hash FROM users WHERE username = ? AND deleted_at IS NULL",
+		"SELECT id, name, role, username, password_hash, token_version, totp_enabled FROM users WHERE username = ? AND deleted_at IS NULL",
 		username,
-	).Scan(&user.ID, &user.Name, &user.Role, &user.Username, &dbPasswordHash)
+	).Scan(&user.ID, &user.Name, &user.Role, &user.Username, &dbPasswordHash, &tokenVersion, &totpEnabled)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("username atau password salah")
+		return nil, s.loginFailed(username, client)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("database error: %w", err)
@@ -48,45 +73,302 @@ func (s *AuthService) Login(username, password string) (*models.LoginResponse, e
 
 	// Verify password
 	if !utils.VerifyPassword(password, dbPasswordHash) {
-		return nil, fmt.Errorf("username atau password salah")
+		return nil, s.loginFailed(username, client)
 	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"role":    user.Role,
-		"exp":     time.Now().Add(time.Hour * time.Duration(s.jwtExpiry)).Unix(),
-		"iat":     time.Now().Unix(),
-	})
+	if err := s.throttle.RecordSuccess(username); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// Upgrade legacy or outdated password hashes now that we know the plaintext
+	if utils.PasswordNeedsRehash(dbPasswordHash) {
+		s.rehashPassword(user.ID, password)
+	}
+
+	// Client policy is checked only after the password so it reveals nothing
+	// about accounts to anonymous callers
+	if err := s.clients.CheckClient(user.Role, client); err != nil {
+		return nil, err
+	}
 
-	tokenString, err := token.SignedString([]byte(s.jwtSecret))
+	switch {
+	case totpEnabled:
+		return s.pendingTwoFactor(&user, ChallengeTOTP)
+	case s.twoFactor.IsRequired(user.Role):
+		return s.pendingTwoFactor(&user, ChallengeEnroll)
+	}
+
+	return s.openSession(&user, tokenVersion, client)
+}
+
+// BeginTwoFactorEnrollment generates the TOTP secret for a user whose login
+// is waiting on mandatory 2FA enrollment
+func (s *AuthService) BeginTwoFactorEnrollment(challengeToken string) (*models.TwoFactorSetup, error) {
+	userID, purpose, err := s.twoFactor.LookupChallenge(challengeToken)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+		return nil, err
+	}
+	if purpose != ChallengeEnroll {
+		return nil, fmt.Errorf("verifikasi dua langkah sudah aktif")
+	}
+
+	return s.twoFactor.BeginSetup(userID)
+}
+
+// CompleteTwoFactor finishes a login that returned a challenge. For a totp
+// challenge the code (or a recovery code) is checked; for an enroll challenge
+// the code confirms the secret from BeginTwoFactorEnrollment and the new
+// recovery codes are returned along with the tokens.
+func (s *AuthService) CompleteTwoFactor(req models.TwoFactorLoginRequest, client models.ClientInfo) (*models.LoginResponse, error) {
+	userID, purpose, err := s.twoFactor.LookupChallenge(req.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	var tokenVersion int
+	err = s.db.QueryRow(
+		"SELECT id, name, role, username, token_version FROM users WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	).Scan(&user.ID, &user.Name, &user.Role, &user.Username, &tokenVersion)
+
+	if err == sql.ErrNoRows {
+		s.twoFactor.DeleteChallenge(req.ChallengeToken)
+		return nil, fmt.Errorf("user tidak ditemukan")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if err := s.throttle.Check(user.Username, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	if err := s.clients.CheckClient(user.Role, client); err != nil {
+		return nil, err
+	}
+
+	var recoveryCodes []string
+	if purpose == ChallengeEnroll {
+		actor := Actor{UserID: user.ID, IPAddress: client.IPAddress, UserAgent: client.UserAgent}
+		recoveryCodes, err = s.twoFactor.Enable(user.ID, req.Code, actor)
+	} else {
+		err = s.twoFactor.VerifyLoginCode(user.ID, req.Code, req.RecoveryCode)
+	}
+	if err != nil {
+		s.twoFactor.FailChallenge(req.ChallengeToken)
+		if lockErr := s.loginFailed(user.Username, client); isCoded(lockErr) {
+			return nil, lockErr
+		}
+		return nil, err
+	}
+
+	s.twoFactor.DeleteChallenge(req.ChallengeToken)
+
+	if err := s.throttle.RecordSuccess(user.Username); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	resp, err := s.openSession(&user, tokenVersion, client)
+	if err != nil {
+		return nil, err
+	}
+	resp.RecoveryCodes = recoveryCodes
+	return resp, nil
+}
+
+// pendingTwoFactor returns a login response that carries only a challenge
+func (s *AuthService) pendingTwoFactor(user *models.User, purpose string) (*models.LoginResponse, error) {
+	challenge, err := s.twoFactor.CreateChallenge(user.ID, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		Role:      user.Role,
+		Username:  user.Username,
+		TwoFactor: challenge,
+	}, nil
+}
+
+// openSession creates the session and issues the access and refresh tokens
+func (s *AuthService) openSession(user *models.User, tokenVersion int, client models.ClientInfo) (*models.LoginResponse, error) {
+	sessionID, err := NewSessionID()
+	if err != nil {
+		return nil, err
 	}
 
-	// Update user with new token in database
 	now := time.Now()
-	tokenExpiry := now.Add(time.Hour * time.Duration(s.jwtExpiry))
+	accessToken, tokenExpiry, err := s.signAccessToken(user, tokenVersion, sessionID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshExpiry := now.Add(s.refreshExpiry)
+	if err := s.sessions.CreateSession(sessionID, user.ID, accessToken, refreshExpiry, client); err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := s.sessions.IssueRefreshToken(sessionID, refreshExpiry)
+	if err != nil {
+		return nil, err
+	}
 
 	_, err = s.db.Exec(
-		"UPDATE users SET token = ?, token_expiry = ?, last_login = ?, updated_at = ? WHERE id = ?",
-		tokenString, tokenExpiry, now, now, user.ID,
+		"UPDATE users SET last_login = ?, updated_at = ? WHERE id = ?",
+		now, now, user.ID,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update user token: %w", err)
+		return nil, fmt.Errorf("failed to update last login: %w", err)
+	}
+
+	err = s.audit.Record(Actor{UserID: user.ID, IPAddress: client.IPAddress, UserAgent: client.UserAgent}, AuditEntry{
+		Action:     AuditLogin,
+		EntityType: EntityUser,
+		EntityID:   user.ID,
+		After: map[string]string{
+			"session_id":  sessionID,
+			"client_type": client.ClientType,
+			"device_name": client.DeviceName,
+		},
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &models.LoginResponse{
-		ID:          user.ID,
-		Name:        user.Name,
-		Role:        user.Role,
-		Username:    user.Username,
-		Token:       tokenString,
-		TokenExpiry: &tokenExpiry,
-		LastLogin:   &now,
+		ID:                 user.ID,
+		Name:               user.Name,
+		Role:               user.Role,
+		Username:           user.Username,
+		Token:              accessToken,
+		TokenExpiry:        &tokenExpiry,
+		RefreshToken:       refreshToken,
+		RefreshTokenExpiry: &refreshExpiry,
+		SessionID:          sessionID,
+		LastLogin:          &now,
 	}, nil
 }
 
+// loginFailed records a failed attempt and returns the error for the client.
+// Unknown usernames are counted too so lockouts do not reveal which exist.
+func (s *AuthService) loginFailed(username string, client models.ClientInfo) error {
+	if err := s.throttle.RecordFailure(username, client.IPAddress); err != nil {
+		if isCoded(err) {
+			return err
+		}
+		log.Printf("Warning: %v", err)
+	}
+	return fmt.Errorf("username atau password salah")
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. The presented refresh token can never be used again. The
+// client policy is checked as on login; a client it rejects loses the session.
+func (s *AuthService) RefreshToken(refreshToken string, client models.ClientInfo) (*models.LoginResponse, error) {
+	sessionID, userID, err := s.sessions.ConsumeRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	var tokenVersion int
+
+	err = s.db.QueryRow(
+		"SELECT id, name, role, username, token_version, last_login FROM users WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	).Scan(&user.ID, &user.Name, &user.Role, &user.Username, &tokenVersion, &user.LastLogin)
+
+	if err == sql.ErrNoRows {
+		s.revokeSessionQuietly(userID, sessionID)
+		return nil, fmt.Errorf("user tidak ditemukan")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if err := s.clients.CheckClient(user.Role, client); err != nil {
+		s.revokeSessionQuietly(userID, sessionID)
+		return nil, err
+	}
+
+	now := time.Now()
+	accessToken, tokenExpiry, err := s.signAccessToken(&user, tokenVersion, sessionID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshExpiry := now.Add(s.refreshExpiry)
+	if err := s.sessions.UpdateSessionToken(sessionID, accessToken, refreshExpiry); err != nil {
+		return nil, err
+	}
+
+	newRefreshToken, err := s.sessions.IssueRefreshToken(sessionID, refreshExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResponse{
+		ID:                 user.ID,
+		Name:               user.Name,
+		Role:               user.Role,
+		Username:           user.Username,
+		Token:              accessToken,
+		TokenExpiry:        &tokenExpiry,
+		RefreshToken:       newRefreshToken,
+		RefreshTokenExpiry: &refreshExpiry,
+		SessionID:          sessionID,
+		LastLogin:          user.LastLogin,
+	}, nil
+}
+
+// signAccessToken generates a short-lived JWT bound to a session
+func (s *AuthService) signAccessToken(user *models.User, tokenVersion int, sessionID string, now time.Time) (string, time.Time, error) {
+	expiry := now.Add(s.accessExpiry)
+
+	tokenString, err := auth.SignToken(&auth.Claims{
+		UserID:       user.ID,
+		Role:         user.Role,
+		SessionID:    sessionID,
+		TokenVersion: tokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiry),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}, s.jwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expiry, nil
+}
+
+// rehashPassword replaces the stored password hash with one in the current
+// format. Failures are only logged so they never block a valid login.
+func (s *AuthService) rehashPassword(userID, password string) {
+	newHash, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("Warning: failed to rehash password for %s: %v", userID, err)
+		return
+	}
+
+	_, err = s.db.Exec(
+		"UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?",
+		newHash, time.Now(), userID,
+	)
+	if err != nil {
+		log.Printf("Warning: failed to store rehashed password for %s: %v", userID, err)
+	}
+}
+
+func (s *AuthService) revokeSessionQuietly(userID, sessionID string) {
+	if err := s.sessions.RevokeSession(userID, sessionID); err != nil {
+		log.Printf("Warning: failed to revoke session %s: %v", sessionID, err)
+	}
+}
+
 // VerifyToken verifies if token is still valid
 func (s *AuthService) VerifyToken(token string) (*models.User, error) {
 	if token == "" {
@@ -94,12 +376,12 @@ func (s *AuthService) VerifyToken(token string) (*models.User, error) {
 	}
 
 	var user models.User
-	var tokenExpiry time.Time
+	var sessionExpiry time.Time
 
 	err := s.db.QueryRow(
-		"SELECT id, name, role, username, token, token_expiry FROM users WHERE token = ? AND deleted_at IS NULL",
-		token,
-	).Scan(&user.ID, &user.Name, &user.Role, &user.Username, &user.Token, &tokenExpiry)
+		"SELECT u.id, u.name, u.role, u.username, s.expires_at FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.token = ? AND u.deleted_at IS NULL",
+		utils.HashToken(token),
+	).Scan(&user.ID, &user.Name, &user.Role, &user.Username, &sessionExpiry)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("token tidak valid")
@@ -108,20 +390,28 @@ func (s *AuthService) VerifyToken(token string) (*models.User, error) {
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 
-	// Check token expiry
-	if time.Now().After(tokenExpiry) {
+	// The session outlives the access token, so check the token's own expiry
+	claims, err := auth.ParseToken(token, s.jwtSecret)
+	if err != nil || claims.ExpiresAt == nil || time.Now().After(sessionExpiry) {
 		return nil, fmt.Errorf("token sudah kadaluarsa")
 	}
 
+	tokenExpiry := claims.ExpiresAt.Time
+	user.Token = token
 	user.TokenExpiry = &tokenExpiry
 	return &user, nil
 }
 
-// Logout invalidates user's token
-func (s *AuthService) Logout(userID string) error {
-	_, err := s.db.Exec(
-		"UPDATE users SET token = NULL, token_expiry = NULL, updated_at = ? WHERE id = ?",
-		time.Now(), userID,
-	)
-	return err
+// Logout ends the session the token was issued for
+func (s *AuthService) Logout(userID, sessionID string, actor Actor) error {
+	if err := s.sessions.RevokeSession(userID, sessionID); err != nil {
+		return err
+	}
+
+	return s.audit.Record(actor, AuditEntry{
+		Action:     AuditLogout,
+		EntityType: EntityUser,
+		EntityID:   userID,
+		Before:     map[string]string{"session_id": sessionID},
+	})
 }
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jimpitan/backend/internal/auth"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/models"
+	"jimpitan/backend/internal/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultConfigID = "default"
+
+	// configCacheTTL bounds how long other server instances keep serving a
+	// stale config after it was changed elsewhere
+	configCacheTTL = 30 * time.Second
+
+	maxApprovalExpiryHours = 24 * 30
+)
+
+// errRulesRelaxed rolls back a config update that needs approval first
+var errRulesRelaxed = errors.New("approval rules relaxed")
+
+// defaultApprovalRules match the column defaults of the approval migration
+var defaultApprovalRules = models.ApprovalRules{
+	ReverseAfterHours: 24,
+	BulkDelete:        true,
+	RoleChange:        true,
+	ExpiryHours:       72,
+}
+
+type ConfigService struct {
+	db        *database.DB
+	audit     *AuditService
+	approvals *ApprovalService
+
+	mu       sync.Mutex
+	cached   *models.Config
+	cachedAt time.Time
+}
+
+func NewConfigService(db *database.DB, audit *AuditService) *ConfigService {
+	return &ConfigService{db: db, audit: audit}
+}
+
+// RegisterApprovals routes config updates that relax the approval rules
+// through approvals. The approval service reads its rules from this service,
+// so it is wired up after both exist. Relaxations can only be approved by
+// users with config.approve, which config.manage holders do not have.
+func (s *ConfigService) RegisterApprovals(approvals *ApprovalService) {
+	s.approvals = approvals
+	approvals.Register(ApprovalUpdateConfig, s.executeUpdate, auth.PermConfigManage)
+	approvals.RequireApprover(ApprovalUpdateConfig, auth.PermConfigApprove)
+}
+
+// GetConfig returns the system configuration
+func (s *ConfigService) GetConfig() (*models.Config, error) {
+	s.mu.Lock()
+	if s.cached != nil && time.Since(s.cachedAt) < configCacheTTL {
+		cfg := *s.cached
+		s.mu.Unlock()
+		return &cfg, nil
+	}
+	s.mu.Unlock()
+
+	cfg, err := loadConfig(s.db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cached = cfg
+	s.cachedAt = time.Now()
+	s.mu.Unlock()
+
+	result := *cfg
+	return &result, nil
+}
+
+// loadConfig reads the config row through q, locking it when lock is set
+func loadConfig(q database.Querier, lock bool) (*models.Config, error) {
+	query := `SELECT id, petugas_web_login_enabled, mobile_app_version, approval_reverse_after_hours, approval_nominal_threshold,
+			approval_bulk_delete, approval_role_change, approval_expiry_hours, updated_at
+		FROM config WHERE id = ?`
+	if lock {
+		query += " FOR UPDATE"
+	}
+
+	var cfg models.Config
+	var petugasWebLogin sql.NullBool
+	var mobileVersion sql.NullString
+	rules := &cfg.ApprovalRules
+	err := q.QueryRow(query, defaultConfigID).Scan(&cfg.ID, &petugasWebLogin, &mobileVersion, &rules.ReverseAfterHours,
+		&rules.NominalThreshold, &rules.BulkDelete, &rules.RoleChange, &rules.ExpiryHours, &cfg.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		// Missing row behaves like the defaults seeded by the migrations
+		return &models.Config{ID: defaultConfigID, PetugasWebLoginEnabled: true, ApprovalRules: defaultApprovalRules}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	cfg.PetugasWebLoginEnabled = !petugasWebLogin.Valid || petugasWebLogin.Bool
+	cfg.MobileAppVersion = mobileVersion.String
+	return &cfg, nil
+}
+
+// UpdateConfig changes the fields set in req. An update that relaxes the
+// approval rules is queued as a whole for approval instead.
+func (s *ConfigService) UpdateConfig(req models.ConfigUpdateRequest, actor Actor) (*models.Config, error) {
+	if req.PetugasWebLoginEnabled == nil && req.MobileAppVersion == nil && req.ApprovalRules == nil {
+		return nil, fmt.Errorf("tidak ada data untuk diupdate")
+	}
+
+	var relaxed []string
+	cfg, err := s.updateConfig(req, actor, func(before, after models.ApprovalRules) error {
+		if relaxed = RelaxedRules(before, after); len(relaxed) > 0 && s.approvals != nil {
+			return errRulesRelaxed
+		}
+		return nil
+	})
+	if err == errRulesRelaxed {
+		summary := "Longgarkan aturan persetujuan: " + strings.Join(relaxed, ", ")
+		return nil, s.approvals.Request(ApprovalUpdateConfig, RuleApprovalRules, summary, req, actor)
+	}
+	return cfg, err
+}
+
+func (s *ConfigService) executeUpdate(payload json.RawMessage, requester *auth.Principal, actor Actor) (interface{}, error) {
+	var req models.ConfigUpdateRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("payload permintaan tidak valid")
+	}
+	return s.updateConfig(req, actor, nil)
+}
+
+// updateConfig applies req to the stored config. check, if set, sees the
+// rules before and after the change and can reject it by returning an error.
+func (s *ConfigService) updateConfig(req models.ConfigUpdateRequest, actor Actor, check func(before, after models.ApprovalRules) error) (*models.Config, error) {
+	var current *models.Config
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		before, err := loadConfig(tx, true)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		if req.PetugasWebLoginEnabled != nil {
+			after.PetugasWebLoginEnabled = *req.PetugasWebLoginEnabled
+		}
+		if req.MobileAppVersion != nil {
+			version := strings.TrimSpace(*req.MobileAppVersion)
+			if version != "" && !utils.ValidVersion(version) {
+				return fmt.Errorf("format mobile_app_version tidak valid, gunakan contoh 1.2.0")
+			}
+			after.MobileAppVersion = version
+		}
+		if req.ApprovalRules != nil {
+			if err := applyApprovalRules(&after.ApprovalRules, req.ApprovalRules); err != nil {
+				return err
+			}
+		}
+		if check != nil {
+			if err := check(before.ApprovalRules, after.ApprovalRules); err != nil {
+				return err
+			}
+		}
+
+		after.UpdatedAt = time.Now()
+		if err := saveConfig(tx, &after); err != nil {
+			return err
+		}
+		current = &after
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditUpdate,
+			EntityType: EntityConfig,
+			EntityID:   defaultConfigID,
+			Before:     before,
+			After:      &after,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	cached := *current
+	s.cached = &cached
+	s.cachedAt = current.UpdatedAt
+	s.mu.Unlock()
+
+	return current, nil
+}
+
+// saveConfig writes cfg as the config row
+func saveConfig(exec database.Execer, cfg *models.Config) error {
+	rules := cfg.ApprovalRules
+	_, err := exec.Exec(
+		`INSERT INTO config (id, petugas_web_login_enabled, mobile_app_version, approval_reverse_after_hours, approval_nominal_threshold,
+			approval_bulk_delete, approval_role_change, approval_expiry_hours, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE petugas_web_login_enabled = VALUES(petugas_web_login_enabled), mobile_app_version = VALUES(mobile_app_version),
+			approval_reverse_after_hours = VALUES(approval_reverse_after_hours), approval_nominal_threshold = VALUES(approval_nominal_threshold),
+			approval_bulk_delete = VALUES(approval_bulk_delete), approval_role_change = VALUES(approval_role_change),
+			approval_expiry_hours = VALUES(approval_expiry_hours), updated_at = VALUES(updated_at)`,
+		defaultConfigID, cfg.PetugasWebLoginEnabled, nullString(cfg.MobileAppVersion), rules.ReverseAfterHours, rules.NominalThreshold,
+		rules.BulkDelete, rules.RoleChange, rules.ExpiryHours, cfg.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update config: %w", err)
+	}
+	return nil
+}
+
+func applyApprovalRules(rules *models.ApprovalRules, req *models.ApprovalRulesUpdateRequest) error {
+	if req.ReverseAfterHours != nil {
+		if *req.ReverseAfterHours < 0 {
+			return fmt.Errorf("reverse_after_hours tidak boleh negatif")
+		}
+		rules.ReverseAfterHours = *req.ReverseAfterHours
+	}
+	if req.NominalThreshold != nil {
+		if *req.NominalThreshold < 0 {
+			return fmt.Errorf("nominal_threshold tidak boleh negatif")
+		}
+		rules.NominalThreshold = *req.NominalThreshold
+	}
+	if req.BulkDelete != nil {
+		rules.BulkDelete = *req.BulkDelete
+	}
+	if req.RoleChange != nil {
+		rules.RoleChange = *req.RoleChange
+	}
+	if req.ExpiryHours != nil {
+		if *req.ExpiryHours < 1 || *req.ExpiryHours > maxApprovalExpiryHours {
+			return fmt.Errorf("expiry_hours harus antara 1 dan %d", maxApprovalExpiryHours)
+		}
+		rules.ExpiryHours = *req.ExpiryHours
+	}
+	return nil
+}
+
+// RelaxedRules returns the config names of the approval rules that after
+// enforces less strictly than before. A zero age or nominal limit disables
+// that rule; a longer expiry leaves requests open for approval longer.
+func RelaxedRules(before, after models.ApprovalRules) []string {
+	var relaxed []string
+	if looserLimit(int64(before.ReverseAfterHours), int64(after.ReverseAfterHours)) {
+		relaxed = append(relaxed, RuleReverseAge)
+	}
+	if looserLimit(int64(before.NominalThreshold), int64(after.NominalThreshold)) {
+		relaxed = append(relaxed, RuleNominal)
+	}
+	if before.BulkDelete && !after.BulkDelete {
+		relaxed = append(relaxed, RuleBulkDelete)
+	}
+	if before.RoleChange && !after.RoleChange {
+		relaxed = append(relaxed, RuleRoleChange)
+	}
+	if after.ExpiryHours > before.ExpiryHours {
+		relaxed = append(relaxed, RuleExpiry)
+	}
+	return relaxed
+}
+
+// looserLimit reports whether a threshold rule, where 0 means off, catches
+// fewer operations at after than at before
+func looserLimit(before, after int64) bool {
+	return before > 0 && (after == 0 || after > before)
+}
+
+// CheckClient enforces the client policy for a user with role: petugas may be
+// barred from the web app, and mobile apps older than the configured minimum
+// version must update. Violations are returned as CodedError.
+func (s *ConfigService) CheckClient(role string, client models.ClientInfo) error {
+	cfg, err := s.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	if client.ClientType == auth.ClientMobile {
+		return checkAppVersion(cfg.MobileAppVersion, client.AppVersion)
+	}
+
+	if role == auth.RolePetugas && !cfg.PetugasWebLoginEnabled {
+		return &CodedError{
+			Code:    ErrCodeWebLoginDisabled,
+			Message: "Login petugas melalui web sedang dinonaktifkan, gunakan aplikasi mobile",
+		}
+	}
+
+	return nil
+}
+
+func checkAppVersion(minVersion, appVersion string) error {
+	if minVersion == "" {
+		return nil
+	}
+
+	cmp, err := utils.CompareVersions(appVersion, minVersion)
+	if err == nil && cmp >= 0 {
+		return nil
+	}
+
+	// Unknown or unparsable versions are treated as outdated
+	return &CodedError{
+		Code:    ErrCodeUpdateRequired,
+		Message: fmt.Sprintf("Versi aplikasi sudah tidak didukung, perbarui ke versi %s atau lebih baru", minVersion),
+		Details: map[string]interface{}{
+			"min_version":     minVersion,
+			"current_version": appVersion,
+		},
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"jimpitan/backend/internal/auth"
+	"jimpitan/backend/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRelaxedRules(t *testing.T) {
+	strict := models.ApprovalRules{ReverseAfterHours: 24, NominalThreshold: 10000000, BulkDelete: true, RoleChange: true, ExpiryHours: 72}
+
+	tests := []struct {
+		name   string
+		change func(r *models.ApprovalRules)
+		want   []string
+	}{
+		{"unchanged", func(r *models.ApprovalRules) {}, nil},
+		{"shorter reverse window", func(r *models.ApprovalRules) { r.ReverseAfterHours = 12 }, nil},
+		{"lower threshold", func(r *models.ApprovalRules) { r.NominalThreshold = 5000000 }, nil},
+		{"shorter expiry", func(r *models.ApprovalRules) { r.ExpiryHours = 24 }, nil},
+		{"longer reverse window", func(r *models.ApprovalRules) { r.ReverseAfterHours = 48 }, []string{RuleReverseAge}},
+		{"reverse window off", func(r *models.ApprovalRules) { r.ReverseAfterHours = 0 }, []string{RuleReverseAge}},
+		{"threshold off", func(r *models.ApprovalRules) { r.NominalThreshold = 0 }, []string{RuleNominal}},
+		{"bulk delete off", func(r *models.ApprovalRules) { r.BulkDelete = false }, []string{RuleBulkDelete}},
+		{"role change off", func(r *models.ApprovalRules) { r.RoleChange = false }, []string{RuleRoleChange}},
+		{"longer expiry", func(r *models.ApprovalRules) { r.ExpiryHours = 96 }, []string{RuleExpiry}},
+		{"everything off", func(r *models.ApprovalRules) { *r = models.ApprovalRules{ExpiryHours: 72} },
+			[]string{RuleReverseAge, RuleNominal, RuleBulkDelete, RuleRoleChange}},
+	}
+	for _, tt := range tests {
+		after := strict
+		tt.change(&after)
+		if got := RelaxedRules(strict, after); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: RelaxedRules = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Turning a disabled rule on is tightening
+	if got := RelaxedRules(models.ApprovalRules{ExpiryHours: 72}, strict); got != nil {
+		t.Errorf("enabling rules: RelaxedRules = %v, want none", got)
+	}
+}
+
+func TestRelaxationApproval(t *testing.T) {
+	configs := NewConfigService(nil, nil)
+	approvals := NewApprovalService(nil, configs, nil)
+	configs.RegisterApprovals(approvals)
+
+	// What UpdateConfig returns once the relaxation is queued
+	request := &models.ApprovalRequest{ID: 7, Action: ApprovalUpdateConfig, Rule: RuleApprovalRules, RequestedBy: "USR-001"}
+	var coded *CodedError
+	if err := approvalRequired(request); !errors.As(err, &coded) || coded.Code != ErrCodeApprovalRequired || coded.Details["approval_request"] != request {
+		t.Fatalf("queued relaxation returned %v, want APPROVAL_REQUIRED with the request", err)
+	}
+
+	tests := []struct {
+		name      string
+		principal auth.Principal
+		reason    string
+	}{
+		{"requester", auth.Principal{UserID: "USR-001", Role: auth.RoleAdmin}, "sendiri"},
+		{"another admin", auth.Principal{UserID: "USR-002", Role: auth.RoleAdmin}, string(auth.PermConfigApprove)},
+		{"ketua rt", auth.Principal{UserID: "USR-003", Role: auth.RoleKetuaRT}, ""},
+	}
+	for _, tt := range tests {
+		err := approvals.checkDecider(request, &tt.principal)
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("%s: rejected: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("%s: checkDecider = %v, want error containing %q", tt.name, err, tt.reason)
+		}
+	}
+
+	// config.manage alone must never be enough to approve a relaxation
+	if auth.HasPermission(auth.RoleAdmin, auth.PermConfigApprove) {
+		t.Error("admin holds config.approve, so config.manage holders could approve relaxations")
+	}
+}
@@ -2,19 +2,34 @@ package services
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"jimpitan/backend/internal/database"
 	"jimpitan/backend/internal/models"
 	"jimpitan/backend/internal/utils"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	defaultCustomerSyncLimit = 500
+	maxCustomerSyncLimit     = 1000
+
+	// customerSyncSettleDelay holds back rows changed in the last moments.
+	// updated_at only has second precision and a write may commit after a
+	// later one, so the newest rows are returned on the next sync instead of
+	// risking that the cursor skips past them.
+	customerSyncSettleDelay = 2 * time.Second
+)
+
 type CustomerService struct {
-	db *database.DB
+	db    *database.DB
+	audit *AuditService
 }
 
-func NewCustomerService(db *database.DB) *CustomerService {
-	return &CustomerService{db: db}
+func NewCustomerService(db *database.DB, audit *AuditService) *CustomerService {
+	return &CustomerService{db: db, audit: audit}
 }
 
 // GetAllCustomers returns all active customers
@@ -77,62 +92,176 @@ func (s *CustomerService) GetCustomerByQRHash(qrHash string) (*models.Customer,
 }
 
 // CreateCustomer creates a new customer
-func (s *CustomerService) CreateCustomer(blok, nama string) (*models.Customer, error) {
+func (s *CustomerService) CreateCustomer(blok, nama string, actor Actor) (*models.Customer, error) {
 	if blok == "" || nama == "" {
 		return nil, fmt.Errorf("blok dan nama harus diisi")
 	}
 
-	// Get next customer number
-	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM customers").Scan(&count)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get customer count: %w", err)
+	now := time.Now()
+	customer := &models.Customer{
+		Blok:      blok,
+		Nama:      nama,
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
-	customerID := utils.GenerateCustomerID(count)
-	qrHash := utils.GenerateQRHash(customerID)
-	now := time.Now()
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		seq, err := database.NextSequence(tx, database.SeqCustomers)
+		if err != nil {
+			return err
+		}
+		customer.ID = utils.GenerateCustomerID(seq)
+		customer.QRHash = utils.GenerateQRHash(customer.ID)
 
-	_, err = s.db.Exec(
-		"INSERT INTO customers (id, blok, nama, qr_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
-		customerID, blok, nama, qrHash, now, now,
-	)
+		_, err = tx.Exec(
+			"INSERT INTO customers (id, blok, nama, qr_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+			customer.ID, blok, nama, customer.QRHash, now, now,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create customer: %w", err)
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditCreate,
+			EntityType: EntityCustomer,
+			EntityID:   customer.ID,
+			After:      customer,
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create customer: %w", err)
+		return nil, err
 	}
 
-	return &models.Customer{
-		ID:        customerID,
-		Blok:      blok,
-		Nama:      nama,
-		QRHash:    qrHash,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}, nil
+	return customer, nil
 }
 
 // UpdateCustomer updates customer data
-func (s *CustomerService) UpdateCustomer(id, blok, nama string) error {
-	_, err := s.db.Exec(
-		"UPDATE customers SET blok = ?, nama = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL",
-		blok, nama, time.Now(), id,
-	)
-	return err
+func (s *CustomerService) UpdateCustomer(id, blok, nama string, actor Actor) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		before, err := lockCustomer(tx, id, false)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.Blok, after.Nama, after.UpdatedAt = blok, nama, time.Now()
+
+		_, err = tx.Exec(
+			"UPDATE customers SET blok = ?, nama = ?, updated_at = ? WHERE id = ?",
+			blok, nama, after.UpdatedAt, id,
+		)
+		if err != nil {
+			return err
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditUpdate,
+			EntityType: EntityCustomer,
+			EntityID:   id,
+			Before:     before,
+			After:      &after,
+		})
+	})
 }
 
 // DeleteCustomer soft deletes a customer
-func (s *CustomerService) DeleteCustomer(id string) error {
-	_, err := s.db.Exec(
-		"UPDATE customers SET deleted_at = ? WHERE id = ?",
-		time.Now(), id,
+func (s *CustomerService) DeleteCustomer(id string, actor Actor) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		before, err := lockCustomer(tx, id, false)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("UPDATE customers SET deleted_at = ? WHERE id = ?", time.Now(), id); err != nil {
+			return err
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditDelete,
+			EntityType: EntityCustomer,
+			EntityID:   id,
+			Before:     before,
+		})
+	})
+}
+
+// lockCustomer reads an active (or, with deleted set, a soft-deleted)
+// customer for an audited change and locks the row
+func lockCustomer(tx *sql.Tx, id string, deleted bool) (*models.Customer, error) {
+	query := "SELECT id, blok, nama, qr_hash, created_at, updated_at, total_setoran, last_transaction, deleted_at FROM customers WHERE id = ? AND deleted_at IS NULL FOR UPDATE"
+	if deleted {
+		query = "SELECT id, blok, nama, qr_hash, created_at, updated_at, total_setoran, last_transaction, deleted_at FROM customers WHERE id = ? AND deleted_at IS NOT NULL FOR UPDATE"
+	}
+
+	var c models.Customer
+	err := tx.QueryRow(query, id).Scan(&c.ID, &c.Blok, &c.Nama, &c.QRHash, &c.CreatedAt, &c.UpdatedAt, &c.TotalSetoran, &c.LastTransaction, &c.DeletedAt)
+	if err == sql.ErrNoRows {
+		if deleted {
+			return nil, fmt.Errorf("customer tidak ditemukan di tempat sampah")
+		}
+		return nil, fmt.Errorf("customer tidak ditemukan")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &c, nil
+}
+
+// GetDeletedCustomers returns soft-deleted customers, most recently deleted first
+func (s *CustomerService) GetDeletedCustomers() ([]models.Customer, error) {
+	rows, err := s.db.Query(
+		"SELECT id, blok, nama, qr_hash, created_at, updated_at, total_setoran, last_transaction, deleted_at FROM customers WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC",
 	)
-	return err
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customers: %w", err)
+	}
+	defer rows.Close()
+
+	customers := []models.Customer{}
+	for rows.Next() {
+		var c models.Customer
+		err := rows.Scan(&c.ID, &c.Blok, &c.Nama, &c.QRHash, &c.CreatedAt, &c.UpdatedAt, &c.TotalSetoran, &c.LastTransaction, &c.DeletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan customer: %w", err)
+		}
+		customers = append(customers, c)
+	}
+
+	return customers, rows.Err()
+}
+
+// RestoreCustomer undoes a soft delete. Deleting a customer leaves their
+// transactions and balance untouched, so nothing else needs re-applying;
+// bumping updated_at makes delta sync hand the customer out again.
+func (s *CustomerService) RestoreCustomer(id string, actor Actor) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		before, err := lockCustomer(tx, id, true)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.DeletedAt = nil
+		after.UpdatedAt = time.Now()
+
+		if _, err := tx.Exec("UPDATE customers SET deleted_at = NULL, updated_at = ? WHERE id = ?", after.UpdatedAt, id); err != nil {
+			return fmt.Errorf("gagal memulihkan customer: %w", err)
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditRestore,
+			EntityType: EntityCustomer,
+			EntityID:   id,
+			Before:     before,
+			After:      &after,
+		})
+	})
 }
 
 // GetCustomerHistory returns all transactions for a customer
 func (s *CustomerService) GetCustomerHistory(customerID string) ([]models.Transaction, error) {
 	rows, err := s.db.Query(
-		"SELECT id, timestamp, customer_id, blok, nama, nominal, user_id, petugas, created_at FROM transactions WHERE customer_id = ? AND deleted_at IS NULL ORDER BY timestamp DESC",
+		"SELECT "+transactionColumns+" FROM transactions WHERE customer_id = ? AND deleted_at IS NULL ORDER BY timestamp DESC",
 		customerID,
 	)
 	if err != nil {
@@ -143,7 +272,7 @@ func (s *CustomerService) GetCustomerHistory(customerID string) ([]models.Transa
 	var transactions []models.Transaction
 	for rows.Next() {
 		var t models.Transaction
-		err := rows.Scan(&t.ID, &t.Timestamp, &t.CustomerID, &t.Blok, &t.Nama, &t.Nominal, &t.UserID, &t.Petugas, &t.CreatedAt)
+		err := scanTransaction(rows, &t)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan transaction: %w", err)
 		}
@@ -153,11 +282,119 @@ func (s *CustomerService) GetCustomerHistory(customerID string) ([]models.Transa
 	return transactions, rows.Err()
 }
 
-// UpdateCustomerStats updates customer's total setoran and last transaction
-func (s *CustomerService) UpdateCustomerStats(customerID string, amount float64) error {
-	_, err := s.db.Exec(
-		"UPDATE customers SET total_setoran = total_setoran + ?, last_transaction = ?, updated_at = ? WHERE id = ?",
-		amount, time.Now(), time.Now(), customerID,
+// addCustomerDeposit adds a deposit made at the given time to the customer's
+// total setoran and last transaction. Run it on the same *sql.Tx as the
+// ledger write. Late uploads of older deposits do not move last_transaction back.
+func addCustomerDeposit(exec database.Execer, customerID string, amount models.Money, at time.Time) error {
+	_, err := exec.Exec(
+		"UPDATE customers SET total_setoran = total_setoran + ?, last_transaction = GREATEST(COALESCE(last_transaction, ?), ?), updated_at = ? WHERE id = ?",
+		amount, at, at, time.Now(), customerID,
 	)
 	return err
 }
+
+// removeCustomerDeposit takes a deposit that moved to another customer off
+// this customer's total setoran and recomputes last_transaction from the
+// remaining deposits. Run it after the ledger row has been updated.
+func removeCustomerDeposit(exec database.Execer, customerID string, amount models.Money) error {
+	_, err := exec.Exec(
+		`UPDATE customers SET total_setoran = total_setoran - ?,
+		last_transaction = (SELECT MAX(timestamp) FROM transactions WHERE customer_id = ? AND deleted_at IS NULL),
+		updated_at = ? WHERE id = ?`,
+		amount, customerID, time.Now(), customerID,
+	)
+	return err
+}
+
+// SyncCustomers returns customers changed after cursor, ordered by
+// (updated_at, id). An empty cursor starts a full sync, which leaves out
+// deleted customers; later pages list them in Deleted as tombstones.
+func (s *CustomerService) SyncCustomers(cursor string, limit int) (*models.CustomerSync, error) {
+	if limit <= 0 {
+		limit = defaultCustomerSyncLimit
+	}
+	if limit > maxCustomerSyncLimit {
+		limit = maxCustomerSyncLimit
+	}
+
+	query := "SELECT id, blok, nama, qr_hash, updated_at, deleted_at IS NOT NULL FROM customers WHERE updated_at <= ?"
+	args := []interface{}{time.Now().Add(-customerSyncSettleDelay)}
+
+	if cursor == "" {
+		query += " AND deleted_at IS NULL"
+	} else {
+		since, lastID, err := decodeCustomerCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query += " AND (updated_at > ? OR (updated_at = ? AND id > ?))"
+		args = append(args, since, since, lastID)
+	}
+
+	query += " ORDER BY updated_at, id LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customers: %w", err)
+	}
+	defer rows.Close()
+
+	result := &models.CustomerSync{
+		Customers:  []models.CustomerSyncEntry{},
+		Deleted:    []string{},
+		NextCursor: cursor,
+	}
+
+	count := 0
+	for rows.Next() {
+		if count == limit {
+			result.HasMore = true
+			break
+		}
+		count++
+
+		var c models.CustomerSyncEntry
+		var updatedAt time.Time
+		var deleted bool
+		if err := rows.Scan(&c.ID, &c.Blok, &c.Nama, &c.QRHash, &updatedAt, &deleted); err != nil {
+			return nil, fmt.Errorf("failed to scan customer: %w", err)
+		}
+
+		if deleted {
+			result.Deleted = append(result.Deleted, c.ID)
+		} else {
+			result.Customers = append(result.Customers, c)
+		}
+		result.NextCursor = encodeCustomerCursor(updatedAt, c.ID)
+	}
+
+	return result, rows.Err()
+}
+
+// The cursor is opaque to clients: base64url("<unix seconds>:<customer id>")
+func encodeCustomerCursor(updatedAt time.Time, id string) string {
+	raw := strconv.FormatInt(updatedAt.Unix(), 10) + ":" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCustomerCursor(cursor string) (time.Time, string, error) {
+	invalid := fmt.Errorf("cursor tidak valid")
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", invalid
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return time.Time{}, "", invalid
+	}
+
+	unix, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", invalid
+	}
+
+	return time.Unix(unix, 0), parts[1], nil
+}
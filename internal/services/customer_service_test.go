@@ -0,0 +1,52 @@
+package services
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCustomerCursorRoundTrip(t *testing.T) {
+	updatedAt := time.Date(2024, 3, 5, 7, 30, 15, 0, time.Local)
+	for _, id := range []string{"CUST-001", "CUST:with:colons"} {
+		cursor := encodeCustomerCursor(updatedAt, id)
+
+		since, lastID, err := decodeCustomerCursor(cursor)
+		if err != nil {
+			t.Fatalf("decodeCustomerCursor(%q): %v", cursor, err)
+		}
+		if !since.Equal(updatedAt) || lastID != id {
+			t.Errorf("decoded (%s, %q), want (%s, %q)", since, lastID, updatedAt, id)
+		}
+	}
+}
+
+func TestCustomerCursorDropsSubSecond(t *testing.T) {
+	updatedAt := time.Date(2024, 3, 5, 7, 30, 15, 999_000_000, time.UTC)
+	since, _, err := decodeCustomerCursor(encodeCustomerCursor(updatedAt, "CUST-001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !since.Equal(updatedAt.Truncate(time.Second)) {
+		t.Errorf("since = %s, want %s", since, updatedAt.Truncate(time.Second))
+	}
+}
+
+func TestCustomerCursorRejects(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	for name, cursor := range map[string]string{
+		"not base64":    "!!!",
+		"padded base64": base64.URLEncoding.EncodeToString([]byte("1700000000:CUST-0")),
+		"no separator":  encode("1700000000"),
+		"empty id":      encode("1700000000:"),
+		"bad timestamp": encode("yesterday:CUST-001"),
+		"empty":         encode(""),
+		"float seconds": encode("1700000000.5:CUST-001"),
+	} {
+		if _, _, err := decodeCustomerCursor(cursor); err == nil {
+			t.Errorf("%s: cursor %q accepted", name, cursor)
+		}
+	}
+}
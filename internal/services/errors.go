@@ -0,0 +1,35 @@
+package services
+
+import "errors"
+
+// Error codes returned to API clients alongside the message
+const (
+	ErrCodeAccountLocked        = "ACCOUNT_LOCKED"
+	ErrCodeTooManyAttempts      = "TOO_MANY_ATTEMPTS"
+	ErrCodeWebLoginDisabled     = "WEB_LOGIN_DISABLED"
+	ErrCodeUpdateRequired       = "UPDATE_REQUIRED"
+	ErrCodeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+	ErrCodeRestoreConflict      = "RESTORE_CONFLICT"
+	ErrCodeAlreadyReversed      = "ALREADY_REVERSED"
+	ErrCodeApprovalRequired     = "APPROVAL_REQUIRED"
+	ErrCodeApprovalFailed       = "APPROVAL_FAILED"
+	ErrCodePeriodClosed         = "PERIOD_CLOSED"
+)
+
+// CodedError is a service error that carries a machine-readable code so
+// clients can react without parsing the (Indonesian) message
+type CodedError struct {
+	Code    string
+	Message string
+	Details map[string]interface{}
+}
+
+func (e *CodedError) Error() string {
+	return e.Message
+}
+
+// isCoded reports whether err is (or wraps) a CodedError
+func isCoded(err error) bool {
+	var coded *CodedError
+	return errors.As(err, &coded)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/utils"
+	"time"
+)
+
+const (
+	// idempotencyRetention is how long a key replays its stored response
+	idempotencyRetention = 24 * time.Hour
+
+	maxIdempotencyKeyLength = 100
+)
+
+type IdempotencyService struct {
+	db *database.DB
+}
+
+func NewIdempotencyService(db *database.DB) *IdempotencyService {
+	return &IdempotencyService{db: db}
+}
+
+// RequestHash fingerprints a request payload so a reused key can be told
+// apart from a genuine retry
+func RequestHash(payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash request: %w", err)
+	}
+	return utils.HashToken(string(data)), nil
+}
+
+// ValidateKey checks the format of a client supplied key
+func (s *IdempotencyService) ValidateKey(key string) error {
+	if len(key) > maxIdempotencyKeyLength {
+		return fmt.Errorf("idempotency key maksimal %d karakter", maxIdempotencyKeyLength)
+	}
+	return nil
+}
+
+// Lookup loads the stored response of a key into dest. It reports false when
+// the key is unknown or expired, and returns a CodedError when the key was
+// used for a different request.
+func (s *IdempotencyService) Lookup(userID, key, requestHash string, dest interface{}) (bool, error) {
+	var storedHash string
+	var response []byte
+	err := s.db.QueryRow(
+		"SELECT request_hash, response FROM idempotency_keys WHERE user_id = ? AND idem_key = ? AND expires_at > ?",
+		userID, key, time.Now(),
+	).Scan(&storedHash, &response)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("database error: %w", err)
+	}
+
+	if storedHash != requestHash {
+		return false, &CodedError{
+			Code:    ErrCodeIdempotencyKeyReused,
+			Message: "Idempotency key sudah dipakai untuk request yang berbeda",
+			Details: map[string]interface{}{"idempotency_key": key},
+		}
+	}
+
+	if err := json.Unmarshal(response, dest); err != nil {
+		return false, fmt.Errorf("failed to decode stored response: %w", err)
+	}
+	return true, nil
+}
+
+// SaveTx stores the response of a key inside the transaction that produced
+// it. A concurrent request with the same key makes this fail with a duplicate
+// key error (see database.IsDuplicateKey), after which the caller should roll
+// back and Lookup the winner's response.
+func (s *IdempotencyService) SaveTx(tx *sql.Tx, userID, key, requestHash string, response interface{}) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to encode response: %w", err)
+	}
+
+	now := time.Now()
+
+	// Drop this user's expired keys, which also lets an expired key be reused
+	if _, err := tx.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND expires_at <= ?", userID, now); err != nil {
+		return fmt.Errorf("failed to clean up idempotency key: %w", err)
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO idempotency_keys (user_id, idem_key, request_hash, response, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, key, requestHash, data, now, now.Add(idempotencyRetention),
+	)
+	return err
+}
@@ -0,0 +1,730 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// genesisHash is the prev_hash of the first chain entry
+var genesisHash = strings.Repeat("0", 64)
+
+// Chain entry kinds
+const (
+	chainKindTransaction = "transaction"
+	chainKindRevision    = "revision"
+	chainKindDeletion    = "deletion"
+)
+
+// chainLink is the position and hashes of one chain entry
+type chainLink struct {
+	Seq      int64
+	PrevHash string
+	Hash     string
+}
+
+// chainTransaction is the canonical, hashed content of a ledger row as it
+// was recorded. Edits are chained as revisions, so customer, blok, nama,
+// nominal and notes are the values before the first revision.
+type chainTransaction struct {
+	Kind       string  `json:"kind"`
+	ID         string  `json:"id"`
+	Timestamp  int64   `json:"timestamp"`
+	CustomerID string  `json:"customer_id"`
+	Blok       string  `json:"blok"`
+	Nama       string  `json:"nama"`
+	Nominal    string  `json:"nominal"`
+	UserID     string  `json:"user_id"`
+	Petugas    string  `json:"petugas"`
+	Notes      *string `json:"notes"`
+	ReversesID *string `json:"reverses_id"`
+	Reason     *string `json:"reason"`
+	CreatedBy  *string `json:"created_by"`
+	CreatedAt  int64   `json:"created_at"`
+}
+
+// chainRevision is the canonical, hashed content of a transaction edit
+type chainRevision struct {
+	Kind          string  `json:"kind"`
+	ID            int64   `json:"id"`
+	TransactionID string  `json:"transaction_id"`
+	OldCustomerID string  `json:"old_customer_id"`
+	NewCustomerID string  `json:"new_customer_id"`
+	OldBlok       string  `json:"old_blok"`
+	NewBlok       string  `json:"new_blok"`
+	OldNama       string  `json:"old_nama"`
+	NewNama       string  `json:"new_nama"`
+	OldNominal    string  `json:"old_nominal"`
+	NewNominal    string  `json:"new_nominal"`
+	OldNotes      *string `json:"old_notes"`
+	NewNotes      *string `json:"new_notes"`
+	Reason        string  `json:"reason"`
+	EditedBy      string  `json:"edited_by"`
+	CreatedAt     int64   `json:"created_at"`
+}
+
+// chainDeletion is the canonical, hashed content of a soft delete or restore
+type chainDeletion struct {
+	Kind          string  `json:"kind"`
+	ID            int64   `json:"id"`
+	TransactionID string  `json:"transaction_id"`
+	Deleted       bool    `json:"deleted"`
+	RecordedBy    *string `json:"recorded_by"`
+	CreatedAt     int64   `json:"created_at"`
+}
+
+// transactionDeletion is a chained change of a transaction's deleted_at
+type transactionDeletion struct {
+	ID            int64
+	TransactionID string
+	Deleted       bool
+	RecordedBy    *string
+	CreatedAt     time.Time
+	link          chainLink
+}
+
+func transactionChainContent(t *models.Transaction) chainTransaction {
+	return chainTransaction{
+		Kind:       chainKindTransaction,
+		ID:         t.ID,
+		Timestamp:  t.Timestamp.Unix(),
+		CustomerID: t.CustomerID,
+		Blok:       t.Blok,
+		Nama:       t.Nama,
+		Nominal:    t.Nominal.String(),
+		UserID:     t.UserID,
+		Petugas:    t.Petugas,
+		Notes:      t.Notes,
+		ReversesID: t.ReversesID,
+		Reason:     t.Reason,
+		CreatedBy:  t.CreatedBy,
+		CreatedAt:  t.CreatedAt.Unix(),
+	}
+}
+
+func revisionChainContent(r *models.TransactionRevision) chainRevision {
+	return chainRevision{
+		Kind:          chainKindRevision,
+		ID:            r.ID,
+		TransactionID: r.TransactionID,
+		OldCustomerID: r.OldCustomerID,
+		NewCustomerID: r.NewCustomerID,
+		OldBlok:       r.OldBlok,
+		NewBlok:       r.NewBlok,
+		OldNama:       r.OldNama,
+		NewNama:       r.NewNama,
+		OldNominal:    r.OldNominal.String(),
+		NewNominal:    r.NewNominal.String(),
+		OldNotes:      r.OldNotes,
+		NewNotes:      r.NewNotes,
+		Reason:        r.Reason,
+		EditedBy:      r.EditedBy,
+		CreatedAt:     r.CreatedAt.Unix(),
+	}
+}
+
+func deletionChainContent(d *transactionDeletion) chainDeletion {
+	return chainDeletion{
+		Kind:          chainKindDeletion,
+		ID:            d.ID,
+		TransactionID: d.TransactionID,
+		Deleted:       d.Deleted,
+		RecordedBy:    d.RecordedBy,
+		CreatedAt:     d.CreatedAt.Unix(),
+	}
+}
+
+// chainHash hashes an entry's canonical content together with the previous
+// entry's hash
+func chainHash(prevHash string, content interface{}) (string, error) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode chain entry: %w", err)
+	}
+	sum := sha256.Sum256([]byte(prevHash + "|" + string(data)))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// appendToChain links content after the current chain head and moves the
+// head. The head row stays locked until tx ends, so appends are serialized;
+// callers must lock customer rows before calling it to keep a single lock
+// order with deposits.
+func appendToChain(tx *sql.Tx, content interface{}) (*chainLink, error) {
+	var head chainLink
+	err := tx.QueryRow("SELECT seq, entry_hash FROM ledger_chain_head WHERE id = 1 FOR UPDATE").Scan(&head.Seq, &head.Hash)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("ledger chain head not found, run the ledger_hash_chain migration")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledger chain head: %w", err)
+	}
+
+	link := &chainLink{Seq: head.Seq + 1, PrevHash: head.Hash}
+	if link.Hash, err = chainHash(link.PrevHash, content); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE ledger_chain_head SET seq = ?, entry_hash = ?, updated_at = ? WHERE id = 1", link.Seq, link.Hash, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to move ledger chain head: %w", err)
+	}
+
+	return link, nil
+}
+
+// insertLedgerEntry chains t and inserts it into transactions. Timestamps
+// must already be whole seconds, as DATETIME stores them.
+func insertLedgerEntry(tx *sql.Tx, t *models.Transaction) error {
+	link, err := appendToChain(tx, transactionChainContent(t))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO transactions (id, timestamp, customer_id, blok, nama, nominal, user_id, petugas, notes, created_at, created_by, reverses_id, reason, chain_seq, prev_hash, entry_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.Timestamp, t.CustomerID, t.Blok, t.Nama, t.Nominal, t.UserID, t.Petugas, t.Notes,
+		t.CreatedAt, t.CreatedBy, t.ReversesID, t.Reason, link.Seq, link.PrevHash, link.Hash,
+	)
+	if err != nil {
+		return err
+	}
+
+	t.ChainSeq, t.EntryHash = &link.Seq, &link.Hash
+	return nil
+}
+
+// insertRevision stores and chains a transaction edit
+func insertRevision(tx *sql.Tx, r *models.TransactionRevision) error {
+	result, err := tx.Exec(
+		`INSERT INTO transaction_revisions (transaction_id, old_customer_id, new_customer_id, old_blok, new_blok, old_nama, new_nama, old_nominal, new_nominal, old_notes, new_notes, reason, edited_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.TransactionID, r.OldCustomerID, r.NewCustomerID, r.OldBlok, r.NewBlok, r.OldNama, r.NewNama, r.OldNominal, r.NewNominal,
+		r.OldNotes, r.NewNotes, r.Reason, r.EditedBy, r.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if r.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+
+	return chainRevisionRow(tx, r)
+}
+
+func chainRevisionRow(tx *sql.Tx, r *models.TransactionRevision) error {
+	link, err := appendToChain(tx, revisionChainContent(r))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE transaction_revisions SET chain_seq = ?, prev_hash = ?, entry_hash = ? WHERE id = ?",
+		link.Seq, link.PrevHash, link.Hash, r.ID,
+	)
+	return err
+}
+
+// insertDeletion stores and chains a soft delete (deleted) or restore of a
+// transaction. recordedBy is nil for deletes chained by backfill.
+func insertDeletion(tx *sql.Tx, transactionID string, deleted bool, recordedBy *string, at time.Time) error {
+	d := &transactionDeletion{TransactionID: transactionID, Deleted: deleted, RecordedBy: recordedBy, CreatedAt: at.Truncate(time.Second)}
+	result, err := tx.Exec(
+		"INSERT INTO transaction_deletions (transaction_id, deleted, recorded_by, created_at) VALUES (?, ?, ?, ?)",
+		d.TransactionID, d.Deleted, d.RecordedBy, d.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if d.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+
+	link, err := appendToChain(tx, deletionChainContent(d))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE transaction_deletions SET chain_seq = ?, prev_hash = ?, entry_hash = ? WHERE id = ?",
+		link.Seq, link.PrevHash, link.Hash, d.ID,
+	)
+	return err
+}
+
+type LedgerChainService struct {
+	db *database.DB
+}
+
+func NewLedgerChainService(db *database.DB) *LedgerChainService {
+	return &LedgerChainService{db: db}
+}
+
+// chainEntry is one chained row: a transaction, revision or deletion
+type chainEntry struct {
+	kind        string
+	transaction models.Transaction
+	revision    models.TransactionRevision
+	deletion    transactionDeletion
+	link        chainLink
+}
+
+func (e *chainEntry) id() string {
+	switch e.kind {
+	case chainKindRevision:
+		return fmt.Sprintf("%d", e.revision.ID)
+	case chainKindDeletion:
+		return fmt.Sprintf("%d", e.deletion.ID)
+	}
+	return e.transaction.ID
+}
+
+// Verify walks the whole chain from the first entry and reports the first
+// broken link (see verifyChain), or a ledger row that is not chained at all.
+func (s *LedgerChainService) Verify() (*models.ChainVerification, error) {
+	report := &models.ChainVerification{CheckedAt: time.Now()}
+
+	if err := s.db.QueryRow("SELECT seq, entry_hash FROM ledger_chain_head WHERE id = 1").Scan(&report.HeadSeq, &report.HeadHash); err != nil {
+		return nil, fmt.Errorf("failed to read ledger chain head: %w", err)
+	}
+
+	revisions, err := s.loadRevisions()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.loadEntries(revisions)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Broken, report.Checked, err = verifyChain(entries, revisions, report.HeadSeq, report.HeadHash)
+	if err != nil {
+		return nil, err
+	}
+	if report.Broken != nil {
+		return report, nil
+	}
+
+	var unchained string
+	err = s.db.QueryRow("SELECT id FROM transactions WHERE chain_seq IS NULL ORDER BY id LIMIT 1").Scan(&unchained)
+	if err == nil {
+		report.Broken = &models.ChainBreak{Kind: chainKindTransaction, ID: unchained, Reason: "transaksi belum masuk rantai (jalankan ledger backfill)"}
+		return report, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	for i := range revisions {
+		if revisions[i].ChainSeq == nil {
+			report.Broken = &models.ChainBreak{Kind: chainKindRevision, ID: fmt.Sprintf("%d", revisions[i].ID), Reason: "revisi belum masuk rantai (jalankan ledger backfill)"}
+			return report, nil
+		}
+	}
+
+	// Deletions are chained when they are written, never by backfill
+	var deletionID int64
+	err = s.db.QueryRow("SELECT id FROM transaction_deletions WHERE chain_seq IS NULL ORDER BY id LIMIT 1").Scan(&deletionID)
+	if err == nil {
+		report.Broken = &models.ChainBreak{Kind: chainKindDeletion, ID: fmt.Sprintf("%d", deletionID), Reason: "penghapusan tidak ada di rantai"}
+		return report, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	report.Valid = true
+	return report, nil
+}
+
+// verifyChain checks chained entries, in chain order, and returns the first
+// break and how many entries were intact before it. A break is a missing
+// entry, a prev_hash that does not match the previous entry, content that no
+// longer matches its hash, a transaction whose current values differ from its
+// last chained revision or whose deleted_at differs from its last chained
+// deletion, or a head that does not point at the last entry. revisions are
+// all revisions, chained or not, oldest first.
+func verifyChain(entries []chainEntry, revisions []models.TransactionRevision, headSeq int64, headHash string) (*models.ChainBreak, int, error) {
+	// Values before the first edit, and after the last, per transaction
+	firstRevision := map[string]*models.TransactionRevision{}
+	lastRevision := map[string]*models.TransactionRevision{}
+	for i := range revisions {
+		r := &revisions[i]
+		if _, ok := firstRevision[r.TransactionID]; !ok {
+			firstRevision[r.TransactionID] = r
+		}
+		lastRevision[r.TransactionID] = r
+	}
+
+	// Whether each transaction should be deleted, per its last deletion
+	deleted := map[string]bool{}
+	for i := range entries {
+		if entries[i].kind == chainKindDeletion {
+			deleted[entries[i].deletion.TransactionID] = entries[i].deletion.Deleted
+		}
+	}
+
+	broken := func(e *chainEntry, seq int64, reason string) *models.ChainBreak {
+		b := &models.ChainBreak{Seq: seq, Reason: reason}
+		if e != nil {
+			b.Kind, b.ID = e.kind, e.id()
+		}
+		return b
+	}
+
+	prevHash := genesisHash
+	for i := range entries {
+		e := &entries[i]
+		expectedSeq := int64(i) + 1
+		if e.link.Seq != expectedSeq {
+			return broken(e, expectedSeq, fmt.Sprintf("entri #%d hilang", expectedSeq)), i, nil
+		}
+		if e.link.PrevHash != prevHash {
+			return broken(e, e.link.Seq, "prev_hash tidak cocok dengan entri sebelumnya"), i, nil
+		}
+
+		var content interface{}
+		switch e.kind {
+		case chainKindRevision:
+			content = revisionChainContent(&e.revision)
+		case chainKindDeletion:
+			content = deletionChainContent(&e.deletion)
+		default:
+			t := e.transaction
+			if r, ok := firstRevision[t.ID]; ok {
+				revertToOriginal(&t, r)
+			}
+			content = transactionChainContent(&t)
+		}
+
+		hash, err := chainHash(e.link.PrevHash, content)
+		if err != nil {
+			return nil, i, err
+		}
+		if hash != e.link.Hash {
+			return broken(e, e.link.Seq, "isi entri tidak cocok dengan hash-nya"), i, nil
+		}
+
+		if e.kind == chainKindTransaction {
+			t := e.transaction
+			if r, ok := lastRevision[t.ID]; ok {
+				if t.CustomerID != r.NewCustomerID || t.Blok != r.NewBlok || t.Nama != r.NewNama ||
+					t.Nominal != r.NewNominal || !sameNotes(t.Notes, r.NewNotes) {
+					return broken(e, e.link.Seq, fmt.Sprintf("nilai transaksi tidak cocok dengan revisi terakhir (%d)", r.ID)), i, nil
+				}
+			}
+			if (t.DeletedAt != nil) != deleted[t.ID] {
+				return broken(e, e.link.Seq, "status hapus transaksi (deleted_at) tidak cocok dengan rantai"), i, nil
+			}
+		}
+
+		prevHash = e.link.Hash
+	}
+
+	if int64(len(entries)) != headSeq || prevHash != headHash {
+		return broken(nil, int64(len(entries))+1, fmt.Sprintf("head rantai menunjuk entri #%d, tetapi hanya %d entri yang ditemukan", headSeq, len(entries))), len(entries), nil
+	}
+
+	return nil, len(entries), nil
+}
+
+// revertToOriginal sets the edited fields of t back to their values before
+// its first revision r
+func revertToOriginal(t *models.Transaction, r *models.TransactionRevision) {
+	t.CustomerID, t.Blok, t.Nama = r.OldCustomerID, r.OldBlok, r.OldNama
+	t.Nominal, t.Notes = r.OldNominal, r.OldNotes
+}
+
+// revisionColumns is the select list read by scanRevision
+const revisionColumns = "id, transaction_id, old_customer_id, new_customer_id, old_blok, new_blok, old_nama, new_nama, " +
+	"old_nominal, new_nominal, old_notes, new_notes, reason, edited_by, created_at, chain_seq, prev_hash, entry_hash"
+
+func scanRevision(row interface{ Scan(...interface{}) error }, r *models.TransactionRevision) error {
+	return row.Scan(&r.ID, &r.TransactionID, &r.OldCustomerID, &r.NewCustomerID, &r.OldBlok, &r.NewBlok, &r.OldNama, &r.NewNama,
+		&r.OldNominal, &r.NewNominal, &r.OldNotes, &r.NewNotes, &r.Reason, &r.EditedBy, &r.CreatedAt, &r.ChainSeq, &r.PrevHash, &r.EntryHash)
+}
+
+// loadRevisions returns every revision, oldest first
+func (s *LedgerChainService) loadRevisions() ([]models.TransactionRevision, error) {
+	rows, err := s.db.Query("SELECT " + revisionColumns + " FROM transaction_revisions ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []models.TransactionRevision{}
+	for rows.Next() {
+		var r models.TransactionRevision
+		if err := scanRevision(rows, &r); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, r)
+	}
+
+	return revisions, rows.Err()
+}
+
+// loadEntries returns the chained transactions, revisions and deletions in
+// chain order
+func (s *LedgerChainService) loadEntries(revisions []models.TransactionRevision) ([]chainEntry, error) {
+	var entries []chainEntry
+
+	rows, err := s.db.Query(
+		"SELECT " + transactionColumns + ", deleted_at, prev_hash FROM transactions WHERE chain_seq IS NOT NULL",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := chainEntry{kind: chainKindTransaction}
+		if err := scanTransaction(rows, &e.transaction, &e.transaction.DeletedAt, &e.link.PrevHash); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		e.link.Seq, e.link.Hash = *e.transaction.ChainSeq, *e.transaction.EntryHash
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, r := range revisions {
+		if r.ChainSeq == nil {
+			continue
+		}
+		e := chainEntry{kind: chainKindRevision, revision: r}
+		e.link = chainLink{Seq: *r.ChainSeq, PrevHash: stringValue(r.PrevHash), Hash: stringValue(r.EntryHash)}
+		entries = append(entries, e)
+	}
+
+	deletionRows, err := s.db.Query(
+		"SELECT id, transaction_id, deleted, recorded_by, created_at, chain_seq, prev_hash, entry_hash FROM transaction_deletions WHERE chain_seq IS NOT NULL",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deletions: %w", err)
+	}
+	defer deletionRows.Close()
+
+	for deletionRows.Next() {
+		e := chainEntry{kind: chainKindDeletion}
+		d := &e.deletion
+		err := deletionRows.Scan(&d.ID, &d.TransactionID, &d.Deleted, &d.RecordedBy, &d.CreatedAt, &e.link.Seq, &e.link.PrevHash, &e.link.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deletion: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := deletionRows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].link.Seq < entries[j].link.Seq })
+	return entries, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// Head returns the last chain entry recorded before until, for publishing
+// at month end, with the ledger total at until. Anyone holding an exported
+// head can later check that the chain still leads to it.
+func (s *LedgerChainService) Head(until time.Time) (*models.ChainHead, error) {
+	head := &models.ChainHead{Until: until, Hash: genesisHash}
+
+	err := s.db.QueryRow(
+		`SELECT seq, hash FROM (
+			SELECT chain_seq AS seq, entry_hash AS hash FROM transactions WHERE chain_seq IS NOT NULL AND created_at < ?
+			UNION ALL
+			SELECT chain_seq, entry_hash FROM transaction_revisions WHERE chain_seq IS NOT NULL AND created_at < ?
+			UNION ALL
+			SELECT chain_seq, entry_hash FROM transaction_deletions WHERE chain_seq IS NOT NULL AND created_at < ?
+		) entries ORDER BY seq DESC LIMIT 1`,
+		until, until, until,
+	).Scan(&head.Seq, &head.Hash)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to query chain head: %w", err)
+	}
+
+	revisions, err := s.loadRevisions()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.loadEntries(revisions)
+	if err != nil {
+		return nil, err
+	}
+	head.Total, head.Transactions = chainTotal(entries, revisions, head.Seq, until)
+
+	return head, nil
+}
+
+// chainTotal sums the transactions chained up to headSeq as they stood at
+// until, so an exported head keeps its total: edits, deletes and restores
+// recorded at or after until are rolled back, earlier ones are applied.
+// revisions are all revisions, oldest first.
+func chainTotal(entries []chainEntry, revisions []models.TransactionRevision, headSeq int64, until time.Time) (models.Money, int) {
+	nominal := map[string]models.Money{}
+	deleted := map[string]bool{}
+	for i := range entries {
+		e := &entries[i]
+		switch {
+		case e.kind == chainKindTransaction && e.link.Seq <= headSeq:
+			nominal[e.transaction.ID] = e.transaction.Nominal
+		case e.kind == chainKindDeletion && e.deletion.CreatedAt.Before(until):
+			deleted[e.deletion.TransactionID] = e.deletion.Deleted
+		}
+	}
+
+	// Undo edits made since until, newest first
+	for i := len(revisions) - 1; i >= 0; i-- {
+		r := &revisions[i]
+		if _, ok := nominal[r.TransactionID]; ok && !r.CreatedAt.Before(until) {
+			nominal[r.TransactionID] = r.OldNominal
+		}
+	}
+
+	var total models.Money
+	var count int
+	for id, amount := range nominal {
+		if deleted[id] {
+			continue
+		}
+		total += amount
+		count++
+	}
+	return total, count
+}
+
+// monthLayout is the format of months and accounting periods (YYYY-MM)
+const monthLayout = "2006-01"
+
+// MonthHead returns the chain head at the end of month (YYYY-MM, local
+// time). An empty month returns the current head.
+func (s *LedgerChainService) MonthHead(month string) (*models.ChainHead, error) {
+	if month == "" {
+		return s.Head(time.Now().Add(time.Second))
+	}
+
+	start, err := time.ParseInLocation(monthLayout, month, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("month harus berformat YYYY-MM")
+	}
+	end := start.AddDate(0, 1, 0)
+	if end.After(time.Now()) {
+		return nil, fmt.Errorf("bulan %s belum berakhir", month)
+	}
+
+	head, err := s.Head(end)
+	if err != nil {
+		return nil, err
+	}
+	head.Month = month
+	return head, nil
+}
+
+// Backfill chains ledger rows written before the chain existed, oldest
+// first, and returns how many entries were added
+func (s *LedgerChainService) Backfill() (int, error) {
+	var chained int
+
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		// Lock the head first, in the same order as every other append
+		if _, err := tx.Exec("SELECT seq FROM ledger_chain_head WHERE id = 1 FOR UPDATE"); err != nil {
+			return fmt.Errorf("failed to lock ledger chain head: %w", err)
+		}
+
+		rows, err := tx.Query("SELECT " + transactionColumns + ", deleted_at FROM transactions WHERE chain_seq IS NULL ORDER BY created_at, id")
+		if err != nil {
+			return fmt.Errorf("failed to query transactions: %w", err)
+		}
+		var pending []models.Transaction
+		for rows.Next() {
+			var t models.Transaction
+			if err := scanTransaction(rows, &t, &t.DeletedAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan transaction: %w", err)
+			}
+			pending = append(pending, t)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		first := map[string]models.TransactionRevision{}
+		revRows, err := tx.Query("SELECT " + revisionColumns + " FROM transaction_revisions ORDER BY id")
+		if err != nil {
+			return fmt.Errorf("failed to query revisions: %w", err)
+		}
+		var pendingRevisions []models.TransactionRevision
+		for revRows.Next() {
+			var r models.TransactionRevision
+			if err := scanRevision(revRows, &r); err != nil {
+				revRows.Close()
+				return fmt.Errorf("failed to scan revision: %w", err)
+			}
+			if _, ok := first[r.TransactionID]; !ok {
+				first[r.TransactionID] = r
+			}
+			if r.ChainSeq == nil {
+				pendingRevisions = append(pendingRevisions, r)
+			}
+		}
+		revRows.Close()
+		if err := revRows.Err(); err != nil {
+			return err
+		}
+
+		for i := range pending {
+			content := pending[i]
+			if r, ok := first[content.ID]; ok {
+				revertToOriginal(&content, &r)
+			}
+
+			link, err := appendToChain(tx, transactionChainContent(&content))
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(
+				"UPDATE transactions SET chain_seq = ?, prev_hash = ?, entry_hash = ? WHERE id = ?",
+				link.Seq, link.PrevHash, link.Hash, content.ID,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to chain transaction %s: %w", content.ID, err)
+			}
+			chained++
+
+			// Soft deleted before reversals replaced deletes
+			if content.DeletedAt != nil {
+				if err := insertDeletion(tx, content.ID, true, nil, *content.DeletedAt); err != nil {
+					return fmt.Errorf("failed to chain deletion of %s: %w", content.ID, err)
+				}
+				chained++
+			}
+		}
+
+		for i := range pendingRevisions {
+			if err := chainRevisionRow(tx, &pendingRevisions[i]); err != nil {
+				return fmt.Errorf("failed to chain revision %d: %w", pendingRevisions[i].ID, err)
+			}
+			chained++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return chained, nil
+}
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"jimpitan/backend/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChainHash(t *testing.T) {
+	content := map[string]string{"kind": "transaction", "id": "0001"}
+	got, err := chainHash(genesisHash, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte(genesisHash + `|{"id":"0001","kind":"transaction"}`))
+	if want := hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("chainHash = %s, want %s", got, want)
+	}
+
+	other, err := chainHash(strings.Repeat("1", 64), content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == got {
+		t.Error("chainHash ignores the previous hash")
+	}
+}
+
+func TestTransactionChainContent(t *testing.T) {
+	tx := testTransaction("0001", "CUST-001", 150000)
+	hash := func(tx models.Transaction) string {
+		h, err := chainHash(genesisHash, transactionChainContent(&tx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	original := hash(tx)
+
+	// Reports and period snapshots group by blok and petugas
+	for name, change := range map[string]func(tx *models.Transaction){
+		"blok":    func(tx *models.Transaction) { tx.Blok = "B" },
+		"nama":    func(tx *models.Transaction) { tx.Nama = "Other" },
+		"petugas": func(tx *models.Transaction) { tx.Petugas = "Other" },
+	} {
+		changed := tx
+		change(&changed)
+		if hash(changed) == original {
+			t.Errorf("hash ignores %s", name)
+		}
+	}
+
+	// Chain columns and deleted_at are not part of the recorded entry
+	seq, entryHash, deletedAt := int64(9), "x", time.Now()
+	tx.ChainSeq, tx.EntryHash, tx.DeletedAt = &seq, &entryHash, &deletedAt
+	if hash(tx) != original {
+		t.Error("hash depends on fields outside the canonical content")
+	}
+}
+
+// testChain builds chain entries in order, linking each to the previous one
+type testChain struct {
+	t         *testing.T
+	entries   []chainEntry
+	revisions []models.TransactionRevision
+}
+
+func (c *testChain) append(e chainEntry, content interface{}) *chainEntry {
+	prev := genesisHash
+	if n := len(c.entries); n > 0 {
+		prev = c.entries[n-1].link.Hash
+	}
+	hash, err := chainHash(prev, content)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	e.link = chainLink{Seq: int64(len(c.entries)) + 1, PrevHash: prev, Hash: hash}
+	c.entries = append(c.entries, e)
+	return &c.entries[len(c.entries)-1]
+}
+
+func (c *testChain) transaction(tx models.Transaction) {
+	c.append(chainEntry{kind: chainKindTransaction, transaction: tx}, transactionChainContent(&tx))
+}
+
+// revise chains an edit of transaction id, moving it to customerID in blok,
+// and applies it to the row
+func (c *testChain) revise(id, customerID, blok string, nominal models.Money) {
+	row := c.row(id)
+	r := models.TransactionRevision{
+		ID:            int64(len(c.revisions)) + 1,
+		TransactionID: id,
+		OldCustomerID: row.CustomerID,
+		NewCustomerID: customerID,
+		OldBlok:       row.Blok,
+		NewBlok:       blok,
+		OldNama:       row.Nama,
+		NewNama:       row.Nama,
+		OldNominal:    row.Nominal,
+		NewNominal:    nominal,
+		Reason:        "salah input",
+		EditedBy:      "USR-001",
+		CreatedAt:     time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	e := c.append(chainEntry{kind: chainKindRevision, revision: r}, revisionChainContent(&r))
+	seq := e.link.Seq
+	r.ChainSeq = &seq
+	e.revision = r
+	c.revisions = append(c.revisions, r)
+
+	// The append may have moved the entries
+	row = c.row(id)
+	row.CustomerID, row.Blok, row.Nominal = customerID, blok, nominal
+}
+
+// delete chains a soft delete (deleted) or restore and applies it to the row
+func (c *testChain) delete(id string, deleted bool) {
+	c.deleteAt(id, deleted, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC))
+}
+
+func (c *testChain) deleteAt(id string, deleted bool, at time.Time) {
+	d := transactionDeletion{ID: int64(len(c.entries)), TransactionID: id, Deleted: deleted, CreatedAt: at}
+	c.append(chainEntry{kind: chainKindDeletion, deletion: d}, deletionChainContent(&d))
+
+	row := c.row(id)
+	row.DeletedAt = nil
+	if deleted {
+		row.DeletedAt = &at
+	}
+}
+
+func (c *testChain) row(id string) *models.Transaction {
+	for i := range c.entries {
+		if c.entries[i].kind == chainKindTransaction && c.entries[i].transaction.ID == id {
+			return &c.entries[i].transaction
+		}
+	}
+	c.t.Fatalf("transaction %s not in chain", id)
+	return nil
+}
+
+func (c *testChain) head() (int64, string) {
+	last := c.entries[len(c.entries)-1].link
+	return last.Seq, last.Hash
+}
+
+func (c *testChain) verify() (*models.ChainBreak, int) {
+	c.t.Helper()
+	headSeq, headHash := c.head()
+	b, checked, err := verifyChain(c.entries, c.revisions, headSeq, headHash)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return b, checked
+}
+
+func testTransaction(id, customerID string, nominal models.Money) models.Transaction {
+	createdBy := "USR-002"
+	ts := time.Date(2024, 1, 1, 19, 0, 0, 0, time.UTC)
+	return models.Transaction{
+		ID: id, Timestamp: ts, CustomerID: customerID, Blok: "A", Nama: "Budi",
+		Nominal: nominal, UserID: "USR-002", Petugas: "Petugas", CreatedBy: &createdBy, CreatedAt: ts,
+	}
+}
+
+// newTestChain returns a valid chain: two deposits, an edit moving the first
+// to another customer in blok B, and a legacy soft delete of the second that
+// was later restored
+func newTestChain(t *testing.T) *testChain {
+	c := &testChain{t: t}
+	c.transaction(testTransaction("0001", "CUST-001", 150000))
+	c.transaction(testTransaction("0002", "CUST-002", 50000))
+	c.revise("0001", "CUST-003", "B", 100000)
+	c.delete("0002", true)
+	c.delete("0002", false)
+	return c
+}
+
+func TestVerifyChainValid(t *testing.T) {
+	c := newTestChain(t)
+	if b, checked := c.verify(); b != nil || checked != 5 {
+		t.Fatalf("verify = %+v, %d checked, want valid with 5", b, checked)
+	}
+
+	c.delete("0001", true)
+	if b, _ := c.verify(); b != nil {
+		t.Fatalf("chained soft delete reported as %+v", b)
+	}
+}
+
+func TestVerifyChainBreaks(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(c *testChain) (headSeq int64, headHash string)
+		seq    int64
+		kind   string
+		reason string
+	}{
+		{
+			name: "nominal edited in place",
+			tamper: func(c *testChain) (int64, string) {
+				c.row("0002").Nominal = 5000000
+				return c.head()
+			},
+			seq: 2, kind: chainKindTransaction, reason: "tidak cocok dengan hash",
+		},
+		{
+			name: "blok moved in place",
+			tamper: func(c *testChain) (int64, string) {
+				c.row("0002").Blok = "C"
+				return c.head()
+			},
+			seq: 2, kind: chainKindTransaction, reason: "tidak cocok dengan hash",
+		},
+		{
+			name: "petugas changed in place",
+			tamper: func(c *testChain) (int64, string) {
+				c.row("0002").Petugas = "Petugas Lain"
+				return c.head()
+			},
+			seq: 2, kind: chainKindTransaction, reason: "tidak cocok dengan hash",
+		},
+		{
+			name: "blok differs from last revision",
+			tamper: func(c *testChain) (int64, string) {
+				c.row("0001").Blok = "A"
+				return c.head()
+			},
+			seq: 1, kind: chainKindTransaction, reason: "revisi terakhir",
+		},
+		{
+			name: "current values differ from last revision",
+			tamper: func(c *testChain) (int64, string) {
+				c.row("0001").Nominal = 150000
+				return c.head()
+			},
+			seq: 1, kind: chainKindTransaction, reason: "revisi terakhir",
+		},
+		{
+			name: "deleted_at set directly",
+			tamper: func(c *testChain) (int64, string) {
+				now := time.Now()
+				c.row("0001").DeletedAt = &now
+				return c.head()
+			},
+			seq: 1, kind: chainKindTransaction, reason: "deleted_at",
+		},
+		{
+			name: "deleted_at cleared after a chained delete",
+			tamper: func(c *testChain) (int64, string) {
+				c.delete("0001", true)
+				c.row("0001").DeletedAt = nil
+				return c.head()
+			},
+			seq: 1, kind: chainKindTransaction, reason: "deleted_at",
+		},
+		{
+			name: "revision rewritten",
+			tamper: func(c *testChain) (int64, string) {
+				c.entries[2].revision.NewNominal = 120000
+				c.row("0001").Nominal = 120000
+				c.revisions[0].NewNominal = 120000
+				return c.head()
+			},
+			seq: 3, kind: chainKindRevision, reason: "tidak cocok dengan hash",
+		},
+		{
+			name: "restore flipped to delete",
+			tamper: func(c *testChain) (int64, string) {
+				c.entries[4].deletion.Deleted = true
+				deletedAt := c.entries[3].deletion.CreatedAt
+				c.row("0002").DeletedAt = &deletedAt
+				return c.head()
+			},
+			seq: 5, kind: chainKindDeletion, reason: "tidak cocok dengan hash",
+		},
+		{
+			name: "entry removed",
+			tamper: func(c *testChain) (int64, string) {
+				c.entries = append(c.entries[:1], c.entries[2:]...)
+				return c.head()
+			},
+			seq: 2, kind: chainKindRevision, reason: "entri #2 hilang",
+		},
+		{
+			name: "entry relinked",
+			tamper: func(c *testChain) (int64, string) {
+				c.entries[1].link.PrevHash = genesisHash
+				return c.head()
+			},
+			seq: 2, kind: chainKindTransaction, reason: "prev_hash",
+		},
+		{
+			name: "last entry removed",
+			tamper: func(c *testChain) (int64, string) {
+				c.transaction(testTransaction("0003", "CUST-001", 20000))
+				seq, hash := c.head()
+				c.entries = c.entries[:len(c.entries)-1]
+				return seq, hash
+			},
+			seq: 6, reason: "head rantai",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChain(t)
+			headSeq, headHash := tt.tamper(c)
+
+			b, _, err := verifyChain(c.entries, c.revisions, headSeq, headHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b == nil {
+				t.Fatal("tampering not detected")
+			}
+			if b.Seq != tt.seq || b.Kind != tt.kind || !strings.Contains(b.Reason, tt.reason) {
+				t.Errorf("break = %+v, want seq %d kind %q reason containing %q", b, tt.seq, tt.kind, tt.reason)
+			}
+		})
+	}
+}
+
+func TestChainTotal(t *testing.T) {
+	day := func(d, h int) time.Time { return time.Date(2024, 1, d, h, 0, 0, 0, time.UTC) }
+
+	// 0001: 150000 on the 1st, edited to 100000 on the 2nd, deleted on the 4th.
+	// 0002: 50000 on the 1st, deleted on the 3rd, restored on the 5th.
+	c := &testChain{t: t}
+	c.transaction(testTransaction("0001", "CUST-001", 150000))
+	c.transaction(testTransaction("0002", "CUST-002", 50000))
+	c.revise("0001", "CUST-001", "A", 100000)
+	c.deleteAt("0002", true, day(3, 0))
+	c.deleteAt("0001", true, day(4, 0))
+	c.deleteAt("0002", false, day(5, 0))
+
+	tests := []struct {
+		until   time.Time
+		headSeq int64
+		total   models.Money
+		count   int
+	}{
+		{day(1, 20), 2, 200000, 2}, // before the edit
+		{day(2, 12), 3, 150000, 2}, // edited
+		{day(3, 12), 4, 100000, 1}, // 0002 deleted
+		{day(4, 12), 5, 0, 0},      // both deleted
+		{day(5, 12), 6, 50000, 1},  // 0002 restored
+	}
+	for _, tt := range tests {
+		total, count := chainTotal(c.entries, c.revisions, tt.headSeq, tt.until)
+		if total != tt.total || count != tt.count {
+			t.Errorf("until %s: total %s over %d, want %s over %d", tt.until.Format(time.RFC3339), total, count, tt.total, tt.count)
+		}
+	}
+}
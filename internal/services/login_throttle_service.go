@@ -0,0 +1,239 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"jimpitan/backend/internal/database"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	throttleScopeUsername = "username"
+	throttleScopeIP       = "ip"
+
+	// Failures older than this no longer count towards a lockout
+	throttleWindow = time.Hour
+
+	// First lockout duration; it doubles with every further failure
+	throttleBaseLockout = time.Minute
+	throttleMaxLockout  = time.Hour
+)
+
+// throttleThresholds is the number of failures after which a scope is locked.
+// IPs get more room because several collectors may share one network.
+var throttleThresholds = map[string]int{
+	throttleScopeUsername: 5,
+	throttleScopeIP:       20,
+}
+
+type LoginThrottleService struct {
+	db     *database.DB
+	events *SecurityEventService
+}
+
+func NewLoginThrottleService(db *database.DB, events *SecurityEventService) *LoginThrottleService {
+	return &LoginThrottleService{db: db, events: events}
+}
+
+// Check returns a CodedError when the username or IP is currently locked
+func (s *LoginThrottleService) Check(username, ip string) error {
+	now := time.Now()
+
+	if until, err := s.lockedUntil(throttleScopeUsername, normalizeUsername(username), now); err != nil {
+		return err
+	} else if until != nil {
+		return accountLockedError(*until, now)
+	}
+
+	if ip == "" {
+		return nil
+	}
+
+	if until, err := s.lockedUntil(throttleScopeIP, ip, now); err != nil {
+		return err
+	} else if until != nil {
+		return tooManyAttemptsError(*until, now)
+	}
+
+	return nil
+}
+
+// RecordFailure counts a failed login for the username and IP. It returns a
+// CodedError when this failure caused a lockout.
+func (s *LoginThrottleService) RecordFailure(username, ip string) error {
+	now := time.Now()
+
+	if until, err := s.recordScopeFailure(throttleScopeUsername, normalizeUsername(username), now); err != nil {
+		return err
+	} else if until != nil {
+		s.events.RecordQuietly(SecurityEvent{
+			Type:      EventAccountLocked,
+			Username:  username,
+			IPAddress: ip,
+			Detail:    fmt.Sprintf("locked until %s", until.Format(time.RFC3339)),
+		})
+		return accountLockedError(*until, now)
+	}
+
+	if ip == "" {
+		return nil
+	}
+
+	if until, err := s.recordScopeFailure(throttleScopeIP, ip, now); err != nil {
+		return err
+	} else if until != nil {
+		s.events.RecordQuietly(SecurityEvent{
+			Type:      EventIPLocked,
+			Username:  username,
+			IPAddress: ip,
+			Detail:    fmt.Sprintf("locked until %s", until.Format(time.RFC3339)),
+		})
+		return tooManyAttemptsError(*until, now)
+	}
+
+	return nil
+}
+
+// RecordSuccess clears the failure counter of a username after a valid login.
+// The IP counter is left alone so one valid account cannot mask guessing
+// against others from the same address.
+func (s *LoginThrottleService) RecordSuccess(username string) error {
+	return s.RecordSuccessTx(s.db, username)
+}
+
+// RecordSuccessTx is RecordSuccess within exec
+func (s *LoginThrottleService) RecordSuccessTx(exec database.Execer, username string) error {
+	_, err := exec.Exec(
+		"DELETE FROM login_throttles WHERE scope = ? AND subject = ?",
+		throttleScopeUsername, normalizeUsername(username),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reset login throttle: %w", err)
+	}
+	return nil
+}
+
+// UnlockUserTx lifts the lockout of a user account within exec
+func (s *LoginThrottleService) UnlockUserTx(exec database.Execer, userID, username, actorID string) error {
+	if err := s.RecordSuccessTx(exec, username); err != nil {
+		return err
+	}
+
+	return s.events.RecordTx(exec, SecurityEvent{
+		Type:     EventAccountUnlocked,
+		UserID:   userID,
+		Username: username,
+		ActorID:  actorID,
+	})
+}
+
+func (s *LoginThrottleService) lockedUntil(scope, subject string, now time.Time) (*time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := s.db.QueryRow(
+		"SELECT locked_until FROM login_throttles WHERE scope = ? AND subject = ?",
+		scope, subject,
+	).Scan(&lockedUntil)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if lockedUntil.Valid && lockedUntil.Time.After(now) {
+		return &lockedUntil.Time, nil
+	}
+	return nil, nil
+}
+
+// recordScopeFailure increments the failure counter and, past the threshold,
+// locks the scope for an exponentially growing duration. It returns the new
+// lock expiry when a lock was applied.
+func (s *LoginThrottleService) recordScopeFailure(scope, subject string, now time.Time) (*time.Time, error) {
+	_, err := s.db.Exec(
+		`INSERT INTO login_throttles (scope, subject, failures, last_failure_at) VALUES (?, ?, 1, ?)
+		ON DUPLICATE KEY UPDATE failures = IF(last_failure_at < ?, 1, failures + 1), last_failure_at = VALUES(last_failure_at)`,
+		scope, subject, now, now.Add(-throttleWindow),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	var failures int
+	err = s.db.QueryRow(
+		"SELECT failures FROM login_throttles WHERE scope = ? AND subject = ?",
+		scope, subject,
+	).Scan(&failures)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	lockout, locked := lockoutDuration(scope, failures)
+	if !locked {
+		return nil, nil
+	}
+	until := now.Add(lockout)
+
+	_, err = s.db.Exec(
+		"UPDATE login_throttles SET locked_until = ? WHERE scope = ? AND subject = ?",
+		until, scope, subject,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	return &until, nil
+}
+
+// lockoutDuration returns how long a scope is locked after failures within
+// the window, or false while it is below the threshold. The first lockout
+// lasts throttleBaseLockout and every further failure doubles it, up to
+// throttleMaxLockout.
+func lockoutDuration(scope string, failures int) (time.Duration, bool) {
+	excess := failures - throttleThresholds[scope]
+	if excess < 0 {
+		return 0, false
+	}
+
+	lockout := throttleBaseLockout
+	for i := 0; i < excess && lockout < throttleMaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > throttleMaxLockout {
+		lockout = throttleMaxLockout
+	}
+	return lockout, true
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func retryAfterSeconds(until, now time.Time) int {
+	return int(math.Ceil(until.Sub(now).Seconds()))
+}
+
+func accountLockedError(until, now time.Time) error {
+	return &CodedError{
+		Code:    ErrCodeAccountLocked,
+		Message: fmt.Sprintf("Akun terkunci sementara karena terlalu banyak percobaan login. Coba lagi dalam %d menit", int(math.Ceil(until.Sub(now).Minutes()))),
+		Details: map[string]interface{}{
+			"locked_until":        until,
+			"retry_after_seconds": retryAfterSeconds(until, now),
+		},
+	}
+}
+
+func tooManyAttemptsError(until, now time.Time) error {
+	return &CodedError{
+		Code:    ErrCodeTooManyAttempts,
+		Message: fmt.Sprintf("Terlalu banyak percobaan login dari alamat ini. Coba lagi dalam %d menit", int(math.Ceil(until.Sub(now).Minutes()))),
+		Details: map[string]interface{}{
+			"locked_until":        until,
+			"retry_after_seconds": retryAfterSeconds(until, now),
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		scope    string
+		failures int
+		want     time.Duration
+		locked   bool
+	}{
+		{throttleScopeUsername, 1, 0, false},
+		{throttleScopeUsername, 4, 0, false},
+		{throttleScopeUsername, 5, time.Minute, true},
+		{throttleScopeUsername, 6, 2 * time.Minute, true},
+		{throttleScopeUsername, 7, 4 * time.Minute, true},
+		{throttleScopeUsername, 10, 32 * time.Minute, true},
+		{throttleScopeUsername, 11, time.Hour, true}, // 64 minutes, capped
+		{throttleScopeUsername, 1000, time.Hour, true},
+		{throttleScopeIP, 19, 0, false},
+		{throttleScopeIP, 20, time.Minute, true},
+		{throttleScopeIP, 22, 4 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		got, locked := lockoutDuration(tt.scope, tt.failures)
+		if got != tt.want || locked != tt.locked {
+			t.Errorf("lockoutDuration(%s, %d) = %s, %t, want %s, %t", tt.scope, tt.failures, got, locked, tt.want, tt.locked)
+		}
+	}
+}
+
+func TestLockoutErrors(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	until := now.Add(90*time.Second + time.Millisecond)
+
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{accountLockedError(until, now), ErrCodeAccountLocked},
+		{tooManyAttemptsError(until, now), ErrCodeTooManyAttempts},
+	}
+	for _, tt := range tests {
+		var coded *CodedError
+		if !errors.As(tt.err, &coded) || coded.Code != tt.code {
+			t.Fatalf("error = %v, want code %s", tt.err, tt.code)
+		}
+		if got := coded.Details["retry_after_seconds"]; got != 91 {
+			t.Errorf("%s retry_after_seconds = %v, want 91", tt.code, got)
+		}
+		if got := coded.Details["locked_until"]; got != until {
+			t.Errorf("%s locked_until = %v, want %v", tt.code, got, until)
+		}
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	if got := normalizeUsername("  Admin "); got != "admin" {
+		t.Errorf("normalizeUsername = %q, want %q", got, "admin")
+	}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/models"
+	"jimpitan/backend/internal/utils"
+	"log"
+	"time"
+)
+
+// passwordResetTTL is how long an issued reset code stays redeemable
+const passwordResetTTL = 30 * time.Minute
+
+var errInvalidResetCode = errors.New("kode reset tidak valid")
+
+type PasswordResetService struct {
+	db       *database.DB
+	sessions *SessionService
+	throttle *LoginThrottleService
+	events   *SecurityEventService
+	audit    *AuditService
+}
+
+func NewPasswordResetService(db *database.DB, sessions *SessionService, throttle *LoginThrottleService, events *SecurityEventService, audit *AuditService) *PasswordResetService {
+	return &PasswordResetService{db: db, sessions: sessions, throttle: throttle, events: events, audit: audit}
+}
+
+// IssueCode creates a single-use reset code for a user. Any code issued
+// earlier for the same user stops working.
+func (s *PasswordResetService) IssueCode(userID string, actor Actor) (*models.PasswordResetCode, error) {
+	code, err := utils.GenerateReadableCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate reset code: %w", err)
+	}
+
+	now := time.Now()
+	issued := &models.PasswordResetCode{
+		UserID:    userID,
+		Code:      code,
+		ExpiresAt: now.Add(passwordResetTTL),
+	}
+
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		user, err := lockUser(tx, userID, false)
+		if err != nil {
+			return err
+		}
+		issued.Username = user.Username
+
+		_, err = tx.Exec(
+			`INSERT INTO password_reset_codes (user_id, code_hash, issued_by, expires_at, created_at) VALUES (?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE code_hash = VALUES(code_hash), issued_by = VALUES(issued_by), expires_at = VALUES(expires_at), created_at = VALUES(created_at)`,
+			userID, utils.HashToken(utils.NormalizeRecoveryCode(code)), actor.UserID, issued.ExpiresAt, now,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store reset code: %w", err)
+		}
+
+		err = s.events.RecordTx(tx, SecurityEvent{
+			Type:      EventResetCodeIssued,
+			UserID:    userID,
+			Username:  user.Username,
+			IPAddress: actor.IPAddress,
+			ActorID:   actor.UserID,
+			Detail:    fmt.Sprintf("expires %s", issued.ExpiresAt.Format(time.RFC3339)),
+		})
+		if err != nil {
+			return err
+		}
+
+		// The code itself is never audited
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditResetCodeIssue,
+			EntityType: EntityUser,
+			EntityID:   userID,
+			After:      map[string]interface{}{"expires_at": issued.ExpiresAt},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return issued, nil
+}
+
+// Redeem sets a new password using a reset code. Consuming the code, the
+// password change, revoking every session of the user and the audit entry
+// commit together; any login lockout is cleared afterwards. Wrong codes count
+// as failed logins so codes cannot be guessed.
+func (s *PasswordResetService) Redeem(req models.PasswordResetRequest, actor Actor) error {
+	if req.Username == "" || req.Code == "" || req.NewPassword == "" {
+		return fmt.Errorf("username, kode dan password baru harus diisi")
+	}
+
+	ip := actor.IPAddress
+	if err := s.throttle.Check(req.Username, ip); err != nil {
+		return err
+	}
+
+	invalid := func() error {
+		if err := s.throttle.RecordFailure(req.Username, ip); err != nil {
+			if isCoded(err) {
+				return err
+			}
+			log.Printf("Warning: %v", err)
+		}
+		return fmt.Errorf("kode reset tidak valid atau sudah kedaluwarsa")
+	}
+
+	var userID string
+	err := s.db.QueryRow("SELECT id FROM users WHERE username = ? AND deleted_at IS NULL", req.Username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return invalid()
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	newHash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// The user redeeming the code is the actor
+	actor.UserID = userID
+
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		// Deleting the row is what makes the code single-use
+		result, err := tx.Exec(
+			"DELETE FROM password_reset_codes WHERE user_id = ? AND code_hash = ? AND expires_at > ?",
+			userID, utils.HashToken(utils.NormalizeRecoveryCode(req.Code)), time.Now(),
+		)
+		if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return errInvalidResetCode
+		}
+
+		_, err = tx.Exec(
+			"UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?",
+			newHash, time.Now(), userID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+
+		if err := s.sessions.RevokeUserTokensTx(tx, userID); err != nil {
+			return err
+		}
+
+		err = s.events.RecordTx(tx, SecurityEvent{
+			Type:      EventPasswordReset,
+			UserID:    userID,
+			Username:  req.Username,
+			IPAddress: ip,
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditPasswordReset,
+			EntityType: EntityUser,
+			EntityID:   userID,
+		})
+	})
+	s.sessions.ForgetUser(userID)
+	if errors.Is(err, errInvalidResetCode) {
+		return invalid()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.throttle.RecordSuccess(req.Username); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"jimpitan/backend/internal/auth"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/models"
+	"time"
+)
+
+// periodOf returns the accounting period (YYYY-MM) containing t
+func periodOf(t time.Time) string {
+	return t.In(time.Local).Format(monthLayout)
+}
+
+// checkPeriodOpen fails with PERIOD_CLOSED when at falls in a closed period.
+// Every ledger change calls it inside its transaction; the share lock on the
+// period row makes a concurrent close wait for the change to commit, so the
+// change is either rejected or included in the closing snapshot.
+func checkPeriodOpen(q database.Querier, at time.Time) error {
+	period := periodOf(at)
+
+	var status string
+	err := q.QueryRow("SELECT status FROM accounting_periods WHERE period = ? LOCK IN SHARE MODE", period).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if status == models.PeriodClosed {
+		return &CodedError{
+			Code:    ErrCodePeriodClosed,
+			Message: fmt.Sprintf("periode %s sudah ditutup, transaksi di periode ini tidak dapat ditambah atau diubah", period),
+			Details: map[string]interface{}{"period": period},
+		}
+	}
+	return nil
+}
+
+// periodPayload is the approval payload of a period reopen
+type periodPayload struct {
+	Period string `json:"period"`
+	Reason string `json:"reason"`
+}
+
+type PeriodService struct {
+	db        *database.DB
+	chain     *LedgerChainService
+	audit     *AuditService
+	approvals *ApprovalService
+}
+
+func NewPeriodService(db *database.DB, chain *LedgerChainService, audit *AuditService, approvals *ApprovalService) *PeriodService {
+	s := &PeriodService{db: db, chain: chain, audit: audit, approvals: approvals}
+	approvals.Register(ApprovalReopenPeriod, s.executeReopen, auth.PermPeriodsClose)
+	approvals.RequireApprover(ApprovalReopenPeriod, auth.PermPeriodsReopen)
+	return s
+}
+
+const periodColumns = "period, status, snapshot, closed_by, closed_at, reopened_by, reopened_at, reopen_reason"
+
+func scanPeriod(row interface{ Scan(...interface{}) error }, p *models.AccountingPeriod) error {
+	var snapshot string
+	err := row.Scan(&p.Period, &p.Status, &snapshot, &p.ClosedBy, &p.ClosedAt, &p.ReopenedBy, &p.ReopenedAt, &p.ReopenReason)
+	if err != nil {
+		return err
+	}
+
+	p.Snapshot = &models.PeriodSnapshot{}
+	if err := json.Unmarshal([]byte(snapshot), p.Snapshot); err != nil {
+		return fmt.Errorf("failed to decode period snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetPeriods returns every period that was ever closed, newest first
+func (s *PeriodService) GetPeriods() ([]models.AccountingPeriod, error) {
+	rows, err := s.db.Query("SELECT " + periodColumns + " FROM accounting_periods ORDER BY period DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query periods: %w", err)
+	}
+	defer rows.Close()
+
+	periods := []models.AccountingPeriod{}
+	for rows.Next() {
+		var p models.AccountingPeriod
+		if err := scanPeriod(rows, &p); err != nil {
+			return nil, fmt.Errorf("failed to scan period: %w", err)
+		}
+		periods = append(periods, p)
+	}
+
+	return periods, rows.Err()
+}
+
+// parsePeriod returns the bounds [start, end) of period (YYYY-MM)
+func parsePeriod(period string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(monthLayout, period, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("period harus berformat YYYY-MM")
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// ClosePeriod closes a month that has ended and stores a snapshot of its
+// totals per blok and per petugas, with the ledger chain head at month end.
+// A reopened period can be closed again; the new snapshot replaces the old
+// one, which stays in the audit log.
+func (s *PeriodService) ClosePeriod(period string, principal *auth.Principal, actor Actor) (*models.AccountingPeriod, error) {
+	start, end, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	if end.After(time.Now()) {
+		return nil, fmt.Errorf("periode %s belum berakhir", period)
+	}
+
+	head, err := s.chain.Head(end)
+	if err != nil {
+		return nil, err
+	}
+
+	var closed models.AccountingPeriod
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		var before models.AccountingPeriod
+		err := scanPeriod(tx.QueryRow("SELECT "+periodColumns+" FROM accounting_periods WHERE period = ? FOR UPDATE", period), &before)
+		exists := err == nil
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if exists && before.Status == models.PeriodClosed {
+			return fmt.Errorf("periode %s sudah ditutup", period)
+		}
+
+		now := time.Now()
+		if !exists {
+			// Insert first: it waits for ledger changes holding a share lock
+			// on the period, so the snapshot below includes them
+			_, err := tx.Exec(
+				"INSERT INTO accounting_periods (period, status, snapshot, closed_by, closed_at) VALUES (?, ?, '{}', ?, ?)",
+				period, models.PeriodClosed, principal.UserID, now,
+			)
+			if err != nil {
+				return fmt.Errorf("gagal menutup periode: %w", err)
+			}
+		}
+
+		summary, err := reportSummary(tx, start, end)
+		if err != nil {
+			return err
+		}
+
+		closed = before
+		closed.Period, closed.Status, closed.ClosedBy, closed.ClosedAt = period, models.PeriodClosed, principal.UserID, now
+		closed.Snapshot = &models.PeriodSnapshot{ReportSummary: *summary, ChainSeq: head.Seq, ChainHash: head.Hash}
+
+		snapshot, err := json.Marshal(closed.Snapshot)
+		if err != nil {
+			return fmt.Errorf("failed to encode period snapshot: %w", err)
+		}
+		_, err = tx.Exec(
+			"UPDATE accounting_periods SET status = ?, snapshot = ?, closed_by = ?, closed_at = ? WHERE period = ?",
+			closed.Status, string(snapshot), closed.ClosedBy, closed.ClosedAt, period,
+		)
+		if err != nil {
+			return fmt.Errorf("gagal menutup periode: %w", err)
+		}
+
+		entry := AuditEntry{Action: AuditClose, EntityType: EntityPeriod, EntityID: period, After: &closed}
+		if exists {
+			entry.Before = &before
+		}
+		return s.audit.RecordTx(tx, actor, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &closed, nil
+}
+
+// ReopenPeriod asks to reopen a closed period. It always needs approval by
+// a user with periods.reopen, so it returns the pending approval request.
+func (s *PeriodService) ReopenPeriod(period, reason string, actor Actor) (*models.ApprovalRequest, error) {
+	if _, _, err := parsePeriod(period); err != nil {
+		return nil, err
+	}
+	reason, err := validateReason(reason)
+	if err != nil {
+		return nil, err
+	}
+
+	var status string
+	err = s.db.QueryRow("SELECT status FROM accounting_periods WHERE period = ?", period).Scan(&status)
+	if err == sql.ErrNoRows || (err == nil && status != models.PeriodClosed) {
+		return nil, fmt.Errorf("periode %s tidak sedang ditutup", period)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	summary := fmt.Sprintf("Buka kembali periode %s: %s", period, reason)
+	return s.approvals.Submit(ApprovalReopenPeriod, RuleReopenPeriod, summary, periodPayload{Period: period, Reason: reason}, actor)
+}
+
+func (s *PeriodService) executeReopen(payload json.RawMessage, requester *auth.Principal, actor Actor) (interface{}, error) {
+	var p periodPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("payload permintaan tidak valid")
+	}
+
+	var reopened models.AccountingPeriod
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		var before models.AccountingPeriod
+		err := scanPeriod(tx.QueryRow("SELECT "+periodColumns+" FROM accounting_periods WHERE period = ? FOR UPDATE", p.Period), &before)
+		if err == sql.ErrNoRows || (err == nil && before.Status != models.PeriodClosed) {
+			return fmt.Errorf("periode %s tidak sedang ditutup", p.Period)
+		}
+		if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		now := time.Now()
+		reopened = before
+		reopened.Status = models.PeriodReopened
+		reopened.ReopenedBy, reopened.ReopenedAt, reopened.ReopenReason = &requester.UserID, &now, &p.Reason
+
+		_, err = tx.Exec(
+			"UPDATE accounting_periods SET status = ?, reopened_by = ?, reopened_at = ?, reopen_reason = ? WHERE period = ?",
+			reopened.Status, requester.UserID, now, p.Reason, p.Period,
+		)
+		if err != nil {
+			return fmt.Errorf("gagal membuka kembali periode: %w", err)
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditReopen,
+			EntityType: EntityPeriod,
+			EntityID:   p.Period,
+			Before:     &before,
+			After:      &reopened,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &reopened, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePeriod(t *testing.T) {
+	start, end, err := parsePeriod("2024-12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStart := time.Date(2024, 12, 1, 0, 0, 0, 0, time.Local)
+	wantEnd := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	if !start.Equal(wantStart) || !end.Equal(wantEnd) {
+		t.Errorf("parsePeriod = [%s, %s), want [%s, %s)", start, end, wantStart, wantEnd)
+	}
+
+	for _, bad := range []string{"", "2024", "2024-13", "2024-1", "12-2024", "2024-01-01"} {
+		if _, _, err := parsePeriod(bad); err == nil {
+			t.Errorf("parsePeriod(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestPeriodOf(t *testing.T) {
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), "2024-01"},
+		{time.Date(2024, 1, 31, 23, 59, 59, 0, time.Local), "2024-01"},
+		{time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local), "2024-02"},
+	}
+	for _, tt := range tests {
+		if got := periodOf(tt.at); got != tt.want {
+			t.Errorf("periodOf(%s) = %s, want %s", tt.at, got, tt.want)
+		}
+	}
+
+	// Every instant of a period falls inside its bounds
+	start, end, err := parsePeriod("2024-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if periodOf(start) != "2024-02" || periodOf(end.Add(-time.Second)) != "2024-02" || periodOf(end) != "2024-03" {
+		t.Error("periodOf disagrees with parsePeriod bounds")
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/models"
+	"log"
+	"time"
+)
+
+type ReconciliationService struct {
+	db     *database.DB
+	events *SecurityEventService
+}
+
+func NewReconciliationService(db *database.DB, events *SecurityEventService) *ReconciliationService {
+	return &ReconciliationService{db: db, events: events}
+}
+
+// Reconcile recomputes every customer's total_setoran and last_transaction
+// from the transactions ledger and reports each mismatch. With fix set, each
+// mismatch is repaired in its own database transaction; actorID (empty for
+// the CLI and scheduler) is recorded with the repair.
+func (s *ReconciliationService) Reconcile(fix bool, actorID string) (*models.ReconcileReport, error) {
+	rows, err := s.db.Query(
+		`SELECT c.id, c.nama, c.total_setoran, c.last_transaction, COALESCE(t.total, 0), t.last_transaction
+		FROM customers c
+		LEFT JOIN (
+			SELECT customer_id, SUM(nominal) AS total, MAX(timestamp) AS last_transaction
+			FROM transactions WHERE deleted_at IS NULL GROUP BY customer_id
+		) t ON t.customer_id = c.id
+		ORDER BY c.id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query balances: %w", err)
+	}
+	defer rows.Close()
+
+	report := &models.ReconcileReport{
+		CheckedAt:  time.Now(),
+		Mismatches: []models.BalanceMismatch{},
+	}
+
+	for rows.Next() {
+		var m models.BalanceMismatch
+		if err := rows.Scan(&m.CustomerID, &m.Nama, &m.StoredTotal, &m.StoredLastTransaction, &m.ExpectedTotal, &m.ExpectedLastTransaction); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		report.Checked++
+
+		if m.StoredTotal != m.ExpectedTotal || !sameTime(m.StoredLastTransaction, m.ExpectedLastTransaction) {
+			report.Mismatches = append(report.Mismatches, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !fix {
+		return report, nil
+	}
+
+	for i := range report.Mismatches {
+		m := &report.Mismatches[i]
+		if err := s.repair(m, actorID); err != nil {
+			log.Printf("Warning: failed to repair balance of %s: %v", m.CustomerID, err)
+			continue
+		}
+		m.Fixed = true
+		report.Fixed++
+	}
+
+	return report, nil
+}
+
+// repair rewrites a customer's aggregates from the ledger. The customer row
+// is locked first; deposits and deletes update that row too, so none can
+// slip in between the recomputation and the write.
+func (s *ReconciliationService) repair(m *models.BalanceMismatch, actorID string) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		var id string
+		if err := tx.QueryRow("SELECT id FROM customers WHERE id = ? FOR UPDATE", m.CustomerID).Scan(&id); err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		_, err := tx.Exec(
+			`UPDATE customers SET
+			total_setoran = (SELECT COALESCE(SUM(nominal), 0) FROM transactions WHERE customer_id = ? AND deleted_at IS NULL),
+			last_transaction = (SELECT MAX(timestamp) FROM transactions WHERE customer_id = ? AND deleted_at IS NULL)
+			WHERE id = ?`,
+			m.CustomerID, m.CustomerID, m.CustomerID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update balance: %w", err)
+		}
+
+		return s.events.RecordTx(tx, SecurityEvent{
+			Type:    EventBalanceRepaired,
+			ActorID: actorID,
+			Detail: fmt.Sprintf("customer %s: total %s -> %s, last_transaction %s -> %s",
+				m.CustomerID, m.StoredTotal, m.ExpectedTotal,
+				formatOptionalTime(m.StoredLastTransaction), formatOptionalTime(m.ExpectedLastTransaction)),
+		})
+	})
+}
+
+// Schedule runs Reconcile every interval in the background and logs the
+// outcome. Call the returned function to stop it.
+func (s *ReconciliationService) Schedule(interval time.Duration, fix bool) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				report, err := s.Reconcile(fix, "")
+				if err != nil {
+					log.Printf("Reconciliation failed: %v", err)
+					continue
+				}
+				for _, m := range report.Mismatches {
+					log.Printf("Reconciliation: %s total %s (expected %s), last_transaction %s (expected %s), fixed=%t",
+						m.CustomerID, m.StoredTotal, m.ExpectedTotal,
+						formatOptionalTime(m.StoredLastTransaction), formatOptionalTime(m.ExpectedLastTransaction), m.Fixed)
+				}
+				log.Printf("Reconciliation: %d customers checked, %d mismatches, %d fixed", report.Checked, len(report.Mismatches), report.Fixed)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/models"
+	"time"
+)
+
+type ReportService struct {
+	db *database.DB
+}
+
+func NewReportService(db *database.DB) *ReportService {
+	return &ReportService{db: db}
+}
+
+// GetSummary returns deposit totals in [from, to) grouped by blok and by petugas
+func (s *ReportService) GetSummary(from, to time.Time) (*models.ReportSummary, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("rentang tanggal tidak valid")
+	}
+
+	return reportSummary(s.db, from, to)
+}
+
+// reportSummary computes the summary through q, so period closing can take
+// its snapshot inside its own transaction
+func reportSummary(q database.Querier, from, to time.Time) (*models.ReportSummary, error) {
+	summary := &models.ReportSummary{From: from, To: to}
+
+	err := q.QueryRow(
+		"SELECT COALESCE(SUM(nominal), 0), COUNT(*) FROM transactions WHERE deleted_at IS NULL AND timestamp >= ? AND timestamp < ?",
+		from, to,
+	).Scan(&summary.Total, &summary.Count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query report total: %w", err)
+	}
+
+	summary.ByBlok, err = groupTotals(q, "blok", "blok", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	summary.ByPetugas, err = groupTotals(q, "user_id", "MAX(petugas)", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// groupTotals sums transactions per keyColumn. Column names are fixed by the
+// callers above, never taken from user input.
+func groupTotals(q database.Querier, keyColumn, labelExpr string, from, to time.Time) ([]models.ReportGroup, error) {
+	rows, err := q.Query(
+		fmt.Sprintf(
+			"SELECT %s, %s, COALESCE(SUM(nominal), 0), COUNT(*) FROM transactions WHERE deleted_at IS NULL AND timestamp >= ? AND timestamp < ? GROUP BY %s ORDER BY %s",
+			keyColumn, labelExpr, keyColumn, keyColumn,
+		),
+		from, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query report groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []models.ReportGroup{}
+	for rows.Next() {
+		var g models.ReportGroup
+		if err := rows.Scan(&g.Key, &g.Label, &g.Total, &g.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan report group: %w", err)
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
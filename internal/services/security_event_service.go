@@ -0,0 +1,64 @@
+package services
+
+import (
+	"fmt"
+	"jimpitan/backend/internal/database"
+	"log"
+	"time"
+)
+
+// Security event types
+const (
+	EventAccountLocked   = "account_locked"
+	EventIPLocked        = "ip_locked"
+	EventAccountUnlocked = "account_unlocked"
+	EventResetCodeIssued = "password_reset_code_issued"
+	EventPasswordReset   = "password_reset"
+	EventOnBehalfDeposit = "transaction_on_behalf"
+	EventBalanceRepaired = "balance_repaired"
+)
+
+// SecurityEvent describes one recorded security event
+type SecurityEvent struct {
+	Type      string
+	UserID    string
+	Username  string
+	IPAddress string
+	ActorID   string
+	Detail    string
+}
+
+type SecurityEventService struct {
+	db *database.DB
+}
+
+func NewSecurityEventService(db *database.DB) *SecurityEventService {
+	return &SecurityEventService{db: db}
+}
+
+// Record stores a security event
+func (s *SecurityEventService) Record(event SecurityEvent) error {
+	return s.RecordTx(s.db, event)
+}
+
+// RecordTx stores a security event through exec, typically the *sql.Tx of
+// the change being audited so both commit together
+func (s *SecurityEventService) RecordTx(exec database.Execer, event SecurityEvent) error {
+	_, err := exec.Exec(
+		"INSERT INTO security_events (event_type, user_id, username, ip_address, actor_id, detail, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		event.Type, nullString(event.UserID), nullString(event.Username), nullString(event.IPAddress),
+		nullString(event.ActorID), nullString(truncate(event.Detail, 512)), time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record security event: %w", err)
+	}
+	return nil
+}
+
+// RecordQuietly stores a security event, only logging failures. Used where
+// losing the event must not fail the user's request.
+func (s *SecurityEventService) RecordQuietly(event SecurityEvent) {
+	if err := s.Record(event); err != nil {
+		log.Printf("Warning: %v (%s)", err, event.Type)
+	}
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/models"
+	"jimpitan/backend/internal/utils"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// sessionTouchInterval limits how often last_seen_at is written per session
+	sessionTouchInterval = time.Minute
+
+	// sessionCacheTTL bounds how long a validated session is trusted without
+	// asking the database again. Revocations made through this process clear
+	// the cache immediately; other server instances see them within the TTL.
+	sessionCacheTTL = 10 * time.Second
+
+	sessionCacheMaxEntries = 10000
+)
+
+type cachedSession struct {
+	userID       string
+	tokenVersion int
+	checkedAt    time.Time
+}
+
+type SessionService struct {
+	db *database.DB
+
+	mu    sync.Mutex
+	cache map[string]cachedSession
+}
+
+func NewSessionService(db *database.DB) *SessionService {
+	return &SessionService{
+		db:    db,
+		cache: make(map[string]cachedSession),
+	}
+}
+
+// NewSessionID generates a random session identifier
+func NewSessionID() (string, error) {
+	return utils.GenerateSecureToken(24)
+}
+
+// CreateSession stores a new session for the given token
+func (s *SessionService) CreateSession(sessionID, userID, token string, expiresAt time.Time, client models.ClientInfo) error {
+	now := time.Now()
+
+	// Drop this user's expired sessions while we are here
+	if _, err := s.db.Exec("DELETE FROM sessions WHERE user_id = ? AND expires_at <= ?", userID, now); err != nil {
+		return fmt.Errorf("failed to clean up sessions: %w", err)
+	}
+
+	_, err := s.db.Exec(
+		"INSERT INTO sessions (id, user_id, token, device_name, user_agent, ip_address, expires_at, last_seen_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		sessionID, userID, utils.HashToken(token), nullString(client.DeviceName), nullString(truncate(client.UserAgent, 512)), nullString(client.IPAddress), expiresAt, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateSessionToken points a session at a newly issued access token and
+// extends its lifetime
+func (s *SessionService) UpdateSessionToken(sessionID, token string, expiresAt time.Time) error {
+	_, err := s.db.Exec(
+		"UPDATE sessions SET token = ?, expires_at = ?, last_seen_at = ? WHERE id = ?",
+		utils.HashToken(token), expiresAt, time.Now(), sessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// IssueRefreshToken creates a new refresh token in the session's family
+func (s *SessionService) IssueRefreshToken(sessionID string, expiresAt time.Time) (string, error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.db.Exec(
+		"INSERT INTO refresh_tokens (session_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)",
+		sessionID, utils.HashToken(token), expiresAt, time.Now(),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// ConsumeRefreshToken marks a refresh token as used and returns its session
+// and user. Presenting a token that was already rotated is treated as theft:
+// the whole family (session) is revoked.
+func (s *SessionService) ConsumeRefreshToken(token string) (string, string, error) {
+	if token == "" {
+		return "", "", fmt.Errorf("refresh token harus diisi")
+	}
+
+	var id int64
+	var sessionID, userID string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+
+	err := s.db.QueryRow(
+		"SELECT rt.id, rt.session_id, s.user_id, rt.expires_at, rt.used_at FROM refresh_tokens rt JOIN sessions s ON s.id = rt.session_id WHERE rt.token_hash = ?",
+		utils.HashToken(token),
+	).Scan(&id, &sessionID, &userID, &expiresAt, &usedAt)
+
+	if err == sql.ErrNoRows {
+		return "", "", fmt.Errorf("refresh token tidak valid")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("database error: %w", err)
+	}
+
+	if usedAt.Valid {
+		s.revokeFamily(sessionID)
+		return "", "", fmt.Errorf("refresh token sudah pernah digunakan, silakan login kembali")
+	}
+
+	now := time.Now()
+	if now.After(expiresAt) {
+		return "", "", fmt.Errorf("refresh token sudah kadaluarsa")
+	}
+
+	result, err := s.db.Exec("UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL", now, id)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		// Lost a race against another use of the same token
+		s.revokeFamily(sessionID)
+		return "", "", fmt.Errorf("refresh token sudah pernah digunakan, silakan login kembali")
+	}
+
+	return sessionID, userID, nil
+}
+
+// revokeFamily deletes a session together with all of its refresh tokens
+func (s *SessionService) revokeFamily(sessionID string) {
+	if _, err := s.db.Exec("DELETE FROM sessions WHERE id = ?", sessionID); err != nil {
+		log.Printf("Warning: failed to revoke session %s: %v", sessionID, err)
+	}
+	s.forget(sessionID)
+}
+
+// ValidateSession checks that a session still exists, belongs to an active
+// userID and was issued for the user's current token version
+func (s *SessionService) ValidateSession(sessionID, userID string, tokenVersion int) error {
+	if sessionID == "" {
+		return fmt.Errorf("sesi tidak valid")
+	}
+
+	now := time.Now()
+	if cached, ok := s.cached(sessionID, now); ok {
+		if cached.userID != userID || cached.tokenVersion != tokenVersion {
+			return fmt.Errorf("sesi tidak valid")
+		}
+		return nil
+	}
+
+	var lastSeen sql.NullTime
+	var currentVersion int
+	err := s.db.QueryRow(
+		"SELECT s.last_seen_at, u.token_version FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.id = ? AND s.user_id = ? AND s.expires_at > ? AND u.deleted_at IS NULL",
+		sessionID, userID, now,
+	).Scan(&lastSeen, &currentVersion)
+
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("sesi sudah berakhir")
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if currentVersion != tokenVersion {
+		return fmt.Errorf("sesi sudah dicabut")
+	}
+
+	s.remember(sessionID, cachedSession{userID: userID, tokenVersion: currentVersion, checkedAt: now})
+
+	if !lastSeen.Valid || now.Sub(lastSeen.Time) > sessionTouchInterval {
+		// Best effort; a failed touch should not reject the request
+		_, _ = s.db.Exec("UPDATE sessions SET last_seen_at = ? WHERE id = ?", now, sessionID)
+	}
+
+	return nil
+}
+
+// GetUserSessions returns all active sessions of a user, marking currentID
+func (s *SessionService) GetUserSessions(userID, currentID string) ([]models.Session, error) {
+	rows, err := s.db.Query(
+		"SELECT id, user_id, device_name, user_agent, ip_address, expires_at, last_seen_at, created_at FROM sessions WHERE user_id = ? AND expires_at > ? ORDER BY created_at DESC",
+		userID, time.Now(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var sess models.Session
+		var deviceName, userAgent, ipAddress sql.NullString
+		err := rows.Scan(&sess.ID, &sess.UserID, &deviceName, &userAgent, &ipAddress, &sess.ExpiresAt, &sess.LastSeenAt, &sess.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sess.DeviceName = deviceName.String
+		sess.UserAgent = userAgent.String
+		sess.IPAddress = ipAddress.String
+		sess.Current = sess.ID == currentID
+		sessions = append(sessions, sess)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession deletes a single session owned by userID
+func (s *SessionService) RevokeSession(userID, sessionID string) error {
+	result, err := s.db.Exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	s.forget(sessionID)
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("sesi tidak ditemukan")
+	}
+
+	return nil
+}
+
+// RevokeAllSessions deletes every session of a user and returns how many were removed
+func (s *SessionService) RevokeAllSessions(userID string) (int64, error) {
+	result, err := s.db.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	s.forgetUser(userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// RevokeUserTokens invalidates every token a user already holds by bumping
+// their token version and dropping their sessions
+func (s *SessionService) RevokeUserTokens(userID string) error {
+	_, err := s.db.Exec("UPDATE users SET token_version = token_version + 1 WHERE id = ?", userID)
+	if err != nil {
+		s.forgetUser(userID)
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+
+	_, err = s.RevokeAllSessions(userID)
+	return err
+}
+
+// RevokeUserTokensTx is RevokeUserTokens within exec, typically the *sql.Tx
+// of the change that requires it. Call ForgetUser once it has committed, so
+// no session is cached from the old state.
+func (s *SessionService) RevokeUserTokensTx(exec database.Execer, userID string) error {
+	if _, err := exec.Exec("UPDATE users SET token_version = token_version + 1 WHERE id = ?", userID); err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+	if _, err := exec.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// ForgetUser drops the cached session checks of a user
+func (s *SessionService) ForgetUser(userID string) {
+	s.forgetUser(userID)
+}
+
+func (s *SessionService) cached(sessionID string, now time.Time) (cachedSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.cache[sessionID]
+	if !ok || now.Sub(entry.checkedAt) > sessionCacheTTL {
+		return cachedSession{}, false
+	}
+	return entry, true
+}
+
+func (s *SessionService) remember(sessionID string, entry cachedSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.cache) >= sessionCacheMaxEntries {
+		for id, e := range s.cache {
+			if entry.checkedAt.Sub(e.checkedAt) > sessionCacheTTL {
+				delete(s.cache, id)
+			}
+		}
+	}
+	s.cache[sessionID] = entry
+}
+
+func (s *SessionService) forget(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cache, sessionID)
+}
+
+func (s *SessionService) forgetUser(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, e := range s.cache {
+		if e.userID == userID {
+			delete(s.cache, id)
+		}
+	}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
@@ -2,25 +2,72 @@ package services
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"jimpitan/backend/internal/auth"
 	"jimpitan/backend/internal/database"
 	"jimpitan/backend/internal/models"
 	"jimpitan/backend/internal/utils"
+	"strings"
 	"time"
 )
 
+const (
+	// maxCaptureClockSkew tolerates phones whose clock runs slightly ahead
+	maxCaptureClockSkew = 5 * time.Minute
+
+	// MaxSyncBatchSize limits how many deposits one sync request may upload
+	MaxSyncBatchSize = 200
+)
+
+// transactionColumns is the select list read by scanTransaction. The last
+// column is the ID of the entry that reversed the row, if any.
+const transactionColumns = "id, timestamp, customer_id, blok, nama, nominal, user_id, petugas, notes, created_at, reverses_id, reason, created_by, chain_seq, entry_hash, " +
+	"(SELECT r.id FROM transactions r WHERE r.reverses_id = transactions.id)"
+
+// scanTransaction reads a row selected with transactionColumns, followed by
+// any extra columns
+func scanTransaction(row interface{ Scan(...interface{}) error }, t *models.Transaction, extra ...interface{}) error {
+	dest := []interface{}{
+		&t.ID, &t.Timestamp, &t.CustomerID, &t.Blok, &t.Nama, &t.Nominal, &t.UserID, &t.Petugas, &t.Notes, &t.CreatedAt,
+		&t.ReversesID, &t.Reason, &t.CreatedBy, &t.ChainSeq, &t.EntryHash, &t.ReversalID,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
+
 type TransactionService struct {
-	db *database.DB
+	db          *database.DB
+	idempotency *IdempotencyService
+	events      *SecurityEventService
+	audit       *AuditService
+	approvals   *ApprovalService
+}
+
+func NewTransactionService(db *database.DB, idempotency *IdempotencyService, events *SecurityEventService, audit *AuditService, approvals *ApprovalService) *TransactionService {
+	s := &TransactionService{db: db, idempotency: idempotency, events: events, audit: audit, approvals: approvals}
+	approvals.Register(ApprovalReverseTransaction, s.executeReverse, auth.PermTransactionsDeleteOwn, auth.PermTransactionsDeleteAny)
+	approvals.Register(ApprovalBulkReverse, s.executeBulkReverse, auth.PermTransactionsDeleteAny)
+	approvals.Register(ApprovalUpdateTransaction, s.executeUpdate, auth.PermTransactionsUpdate)
+	return s
+}
+
+// updatePayload is the approval payload of a transaction edit
+type updatePayload struct {
+	ID string `json:"id"`
+	models.UpdateTransactionRequest
 }
 
-func NewTransactionService(db *database.DB) *TransactionService {
-	return &TransactionService{db: db}
+// reversalPayload is the approval payload of single and bulk reversals
+type reversalPayload struct {
+	IDs    []string `json:"ids"`
+	Reason string   `json:"reason"`
 }
 
 // GetAllTransactions returns all active transactions
 func (s *TransactionService) GetAllTransactions() ([]models.Transaction, error) {
 	rows, err := s.db.Query(
-		"SELECT id, timestamp, customer_id, blok, nama, nominal, user_id, petugas, created_at FROM transactions WHERE deleted_at IS NULL ORDER BY timestamp DESC",
+		"SELECT " + transactionColumns + " FROM transactions WHERE deleted_at IS NULL ORDER BY timestamp DESC",
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query transactions: %w", err)
@@ -30,7 +77,7 @@ func (s *TransactionService) GetAllTransactions() ([]models.Transaction, error)
 	var transactions []models.Transaction
 	for rows.Next() {
 		var t models.Transaction
-		err := rows.Scan(&t.ID, &t.Timestamp, &t.CustomerID, &t.Blok, &t.Nama, &t.Nominal, &t.UserID, &t.Petugas, &t.CreatedAt)
+		err := scanTransaction(rows, &t)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan transaction: %w", err)
 		}
@@ -43,7 +90,7 @@ func (s *TransactionService) GetAllTransactions() ([]models.Transaction, error)
 // GetUserTransactions returns all active transactions for a specific user
 func (s *TransactionService) GetUserTransactions(userID string) ([]models.Transaction, error) {
 	rows, err := s.db.Query(
-		"SELECT id, timestamp, customer_id, blok, nama, nominal, user_id, petugas, created_at FROM transactions WHERE user_id = ? AND deleted_at IS NULL ORDER BY timestamp DESC",
+		"SELECT "+transactionColumns+" FROM transactions WHERE user_id = ? AND deleted_at IS NULL ORDER BY timestamp DESC",
 		userID,
 	)
 	if err != nil {
@@ -54,7 +101,7 @@ func (s *TransactionService) GetUserTransactions(userID string) ([]models.Transa
 	var transactions []models.Transaction
 	for rows.Next() {
 		var t models.Transaction
-		err := rows.Scan(&t.ID, &t.Timestamp, &t.CustomerID, &t.Blok, &t.Nama, &t.Nominal, &t.UserID, &t.Petugas, &t.CreatedAt)
+		err := scanTransaction(rows, &t)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan transaction: %w", err)
 		}
@@ -64,177 +111,832 @@ func (s *TransactionService) GetUserTransactions(userID string) ([]models.Transa
 	return transactions, rows.Err()
 }
 
-// SubmitTransaction creates a new transaction
-func (s *TransactionService) SubmitTransaction(customerID, blok, nama, userID, petugas string, nominal float64) (*models.Transaction, error) {
-	if customerID == "" || userID == "" || nominal <= 0 {
-		return nil, fmt.Errorf("data tidak lengkap atau tidak valid")
+// SubmitTransaction records a deposit by principal. The customer is looked
+// up by ID or QR hash and the collector is the principal, so blok, nama and
+// petugas always come from the database. With OnBehalfOf set, a principal
+// holding transactions.create.on_behalf records the deposit for another
+// collector; that override is written to security_events in the same
+// database transaction as the ledger row and the customer's balance.
+//
+// With an idempotency key, a retry of the same request by the principal
+// returns the transaction created the first time (replayed is true) instead
+// of recording the deposit again. Reusing a key for a different payload
+// fails with ErrCodeIdempotencyKeyReused.
+func (s *TransactionService) SubmitTransaction(req models.SubmitTransactionRequest, principal *auth.Principal, idempotencyKey string, actor Actor) (transaction *models.Transaction, replayed bool, err error) {
+	if (req.CustomerID == "" && req.QRHash == "") || req.Nominal <= 0 {
+		return nil, false, fmt.Errorf("data tidak lengkap atau tidak valid")
+	}
+
+	collectorID := principal.UserID
+	onBehalf := req.OnBehalfOf != "" && req.OnBehalfOf != principal.UserID
+	if onBehalf {
+		if !principal.Can(auth.PermTransactionsOnBehalf) {
+			return nil, false, fmt.Errorf("anda tidak memiliki izin mencatat setoran atas nama petugas lain")
+		}
+		collectorID = req.OnBehalfOf
+	}
+
+	// Whole seconds, as DATETIME stores them, so the chain hash matches the row
+	now := time.Now().Truncate(time.Second)
+	timestamp := now
+	if req.CapturedAt != nil {
+		if req.CapturedAt.After(now.Add(maxCaptureClockSkew)) {
+			return nil, false, fmt.Errorf("captured_at tidak boleh di masa depan")
+		}
+		timestamp = req.CapturedAt.Truncate(time.Second)
+	}
+
+	var requestHash string
+	if idempotencyKey != "" {
+		if err := s.idempotency.ValidateKey(idempotencyKey); err != nil {
+			return nil, false, err
+		}
+
+		payload := req
+		payload.ClientRequestID = ""
+		if requestHash, err = RequestHash(payload); err != nil {
+			return nil, false, err
+		}
+
+		if stored, err := s.replay(principal.UserID, idempotencyKey, requestHash); stored != nil || err != nil {
+			return stored, stored != nil, err
+		}
 	}
 
-	// Get next transaction number
-	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM transactions").Scan(&count)
+	transaction = &models.Transaction{
+		Timestamp: timestamp,
+		Nominal:   req.Nominal,
+		CreatedAt: now,
+		CreatedBy: &principal.UserID,
+	}
+
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		if err := lookupDepositCustomer(tx, req, transaction); err != nil {
+			return err
+		}
+		if err := lookupCollector(tx, collectorID, transaction); err != nil {
+			return err
+		}
+		if err := checkPeriodOpen(tx, timestamp); err != nil {
+			return err
+		}
+
+		seq, err := database.NextSequence(tx, database.SeqTransactions)
+		if err != nil {
+			return err
+		}
+		transaction.ID = utils.GenerateTXID(seq)
+
+		// The customer row is already locked, ahead of the chain head
+		if err := insertLedgerEntry(tx, transaction); err != nil {
+			return fmt.Errorf("failed to create transaction: %w", err)
+		}
+
+		if err := addCustomerDeposit(tx, transaction.CustomerID, transaction.Nominal, timestamp); err != nil {
+			return fmt.Errorf("failed to update customer stats: %w", err)
+		}
+
+		if onBehalf {
+			err := s.events.RecordTx(tx, SecurityEvent{
+				Type:    EventOnBehalfDeposit,
+				UserID:  transaction.UserID,
+				ActorID: principal.UserID,
+				Detail:  fmt.Sprintf("transaction %s: %s for %s", transaction.ID, transaction.Nominal, transaction.CustomerID),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		err = s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditCreate,
+			EntityType: EntityTransaction,
+			EntityID:   transaction.ID,
+			After:      transaction,
+		})
+		if err != nil {
+			return err
+		}
+
+		if idempotencyKey != "" {
+			return s.idempotency.SaveTx(tx, principal.UserID, idempotencyKey, requestHash, transaction)
+		}
+		return nil
+	})
+
+	if err != nil && idempotencyKey != "" && database.IsDuplicateKey(err) {
+		// A concurrent retry with the same key committed first
+		stored, lookupErr := s.replay(principal.UserID, idempotencyKey, requestHash)
+		if stored != nil || lookupErr != nil {
+			return stored, stored != nil, lookupErr
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get transaction count: %w", err)
+		return nil, false, err
 	}
 
-	txID := utils.GenerateTXID(count)
-	now := time.Now()
+	return transaction, false, nil
+}
 
-	_, err = s.db.Exec(
-		"INSERT INTO transactions (id, timestamp, customer_id, blok, nama, nominal, user_id, petugas, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		txID, now, customerID, blok, nama, nominal, userID, petugas, now,
-	)
+// lookupDepositCustomer fills the customer fields of t from the customer
+// identified in req, locking the row for the balance update
+func lookupDepositCustomer(tx *sql.Tx, req models.SubmitTransactionRequest, t *models.Transaction) error {
+	query := "SELECT id, blok, nama, qr_hash FROM customers WHERE id = ? AND deleted_at IS NULL FOR UPDATE"
+	arg := req.CustomerID
+	if arg == "" {
+		query = "SELECT id, blok, nama, qr_hash FROM customers WHERE qr_hash = ? AND deleted_at IS NULL FOR UPDATE"
+		arg = req.QRHash
+	}
+
+	var qrHash string
+	err := tx.QueryRow(query, arg).Scan(&t.CustomerID, &t.Blok, &t.Nama, &qrHash)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("customer tidak ditemukan")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create transaction: %w", err)
+		return fmt.Errorf("database error: %w", err)
 	}
 
-	// Update customer stats
-	customerService := NewCustomerService(s.db)
-	if err := customerService.UpdateCustomerStats(customerID, nominal); err != nil {
-		// Log error but don't fail the transaction creation
-		fmt.Printf("Warning: failed to update customer stats: %v\n", err)
+	if req.QRHash != "" && req.QRHash != qrHash {
+		return fmt.Errorf("qr_hash tidak sesuai dengan customer_id")
 	}
+	return nil
+}
 
-	return &models.Transaction{
-		ID:         txID,
-		Timestamp:  now,
-		CustomerID: customerID,
-		Blok:       blok,
-		Nama:       nama,
-		Nominal:    nominal,
-		UserID:     userID,
-		Petugas:    petugas,
-		CreatedAt:  now,
-	}, nil
+// lookupCollector fills the collector fields of t from the user record
+func lookupCollector(tx *sql.Tx, userID string, t *models.Transaction) error {
+	err := tx.QueryRow(
+		"SELECT id, name FROM users WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	).Scan(&t.UserID, &t.Petugas)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("petugas tidak ditemukan")
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
 }
 
-// DeleteTransaction soft deletes a transaction
-func (s *TransactionService) DeleteTransaction(id string) error {
-	// Get transaction details for customer stats rollback
-	var t models.Transaction
-	err := s.db.QueryRow(
-		"SELECT id, customer_id, nominal FROM transactions WHERE id = ? AND deleted_at IS NULL",
-		id,
-	).Scan(&t.ID, &t.CustomerID, &t.Nominal)
+// SyncTransactions records a batch of deposits queued offline. Every item
+// must carry a client_request_id, which is used as its idempotency key, and
+// goes through SubmitTransaction on its own so one bad item does not affect
+// the rest. Results are returned in request order.
+func (s *TransactionService) SyncTransactions(items []json.RawMessage, principal *auth.Principal, actor Actor) ([]models.SyncItemResult, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("tidak ada transaksi untuk disinkronkan")
+	}
+	if len(items) > MaxSyncBatchSize {
+		return nil, fmt.Errorf("maksimal %d transaksi per sinkronisasi", MaxSyncBatchSize)
+	}
+
+	results := make([]models.SyncItemResult, len(items))
+	for i, raw := range items {
+		var item models.SubmitTransactionRequest
+		decodeErr := json.Unmarshal(raw, &item)
+		if decodeErr != nil {
+			// Still try to echo the id so the app can match the result
+			var ref struct {
+				ClientRequestID string `json:"client_request_id"`
+			}
+			_ = json.Unmarshal(raw, &ref)
+			item.ClientRequestID = ref.ClientRequestID
+		}
+
+		key := strings.TrimSpace(item.ClientRequestID)
+		results[i].ClientRequestID = key
+
+		if decodeErr != nil {
+			results[i].Status = models.SyncRejected
+			results[i].Error = "data transaksi tidak valid"
+			var moneyErr *models.MoneyError
+			if errors.As(decodeErr, &moneyErr) {
+				results[i].Error = moneyErr.Error()
+			}
+			continue
+		}
+
+		if key == "" {
+			results[i].Status = models.SyncRejected
+			results[i].Error = "client_request_id harus diisi"
+			continue
+		}
+
+		transaction, replayed, err := s.SubmitTransaction(item, principal, key, actor)
+		if err != nil {
+			results[i].Status = models.SyncRejected
+			results[i].Error = err.Error()
+			var coded *CodedError
+			if errors.As(err, &coded) {
+				results[i].Code = coded.Code
+			}
+			continue
+		}
+
+		results[i].Transaction = transaction
+		if replayed {
+			results[i].Status = models.SyncDuplicate
+		} else {
+			results[i].Status = models.SyncAccepted
+		}
+	}
+
+	return results, nil
+}
+
+// replay returns the transaction stored for an idempotency key, if any
+func (s *TransactionService) replay(userID, key, requestHash string) (*models.Transaction, error) {
+	var stored models.Transaction
+	found, err := s.idempotency.Lookup(userID, key, requestHash, &stored)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// ReverseTransaction cancels a transaction by recording a linked reversal
+// entry with the negated nominal; the original row is never changed. Without
+// transactions.delete.any, principal may only reverse their own deposits.
+func (s *TransactionService) ReverseTransaction(id, reason string, principal *auth.Principal, actor Actor) (*models.Transaction, error) {
+	reason, err := validateReason(reason)
 	if err != nil {
-		return fmt.Errorf("transaction tidak ditemukan")
+		return nil, err
 	}
 
-	// Soft delete transaction
-	_, err = s.db.Exec(
-		"UPDATE transactions SET deleted_at = ? WHERE id = ?",
-		time.Now(), id,
-	)
+	// Check what can be checked up front so no doomed request is queued
+	original, err := s.GetTransactionByID(id)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if original.ReversesID != nil {
+		return nil, fmt.Errorf("entri pembatalan tidak dapat dibatalkan lagi")
+	}
+	if original.ReversalID != nil {
+		return nil, alreadyReversed(original.ID, *original.ReversalID)
+	}
+	if !principal.Can(auth.PermTransactionsDeleteAny) && original.UserID != principal.UserID {
+		return nil, fmt.Errorf("anda hanya dapat membatalkan transaksi milik anda sendiri")
+	}
+	if err := checkPeriodOpen(s.db, original.Timestamp); err != nil {
+		return nil, err
 	}
 
-	// Rollback customer stats
-	_, err = s.db.Exec(
-		"UPDATE customers SET total_setoran = total_setoran - ?, updated_at = ? WHERE id = ?",
-		t.Nominal, time.Now(), t.CustomerID,
-	)
-	return err
+	rules, err := s.approvals.Rules()
+	if err != nil {
+		return nil, err
+	}
+	if rule := ReversalRule(rules, original); rule != "" {
+		summary := fmt.Sprintf("Batalkan transaksi %s (%s, %s): %s", id, original.CustomerID, original.Nominal, reason)
+		return nil, s.approvals.Request(ApprovalReverseTransaction, rule, summary, reversalPayload{IDs: []string{id}, Reason: reason}, actor)
+	}
+
+	return s.reverseTransaction(id, reason, principal, actor)
 }
 
-// DeleteTransactionWithValidation soft deletes a transaction after validating user permission
-func (s *TransactionService) DeleteTransactionWithValidation(id, userID, userRole string) error {
-	// Get transaction details
-	var t models.Transaction
-	err := s.db.QueryRow(
-		"SELECT id, customer_id, nominal, user_id FROM transactions WHERE id = ? AND deleted_at IS NULL",
-		id,
-	).Scan(&t.ID, &t.CustomerID, &t.Nominal, &t.UserID)
+// reverseTransaction reverses a transaction without approval checks
+func (s *TransactionService) reverseTransaction(id, reason string, principal *auth.Principal, actor Actor) (*models.Transaction, error) {
+	var reversal *models.Transaction
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		var err error
+		reversal, err = s.reverseTransactionTx(tx, id, reason, principal, actor)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("transaksi tidak ditemukan")
+		return nil, err
 	}
 
-	// Validation: petugas hanya bisa hapus transaksi miliknya sendiri
-	if userRole != "admin" && t.UserID != userID {
-		return fmt.Errorf("anda hanya dapat menghapus transaksi milik anda sendiri")
-	}
+	return reversal, nil
+}
 
-	// Soft delete transaction
-	_, err = s.db.Exec(
-		"UPDATE transactions SET deleted_at = ? WHERE id = ?",
-		time.Now(), id,
-	)
+// BulkReverseTransactions reverses multiple transactions with the same
+// reason (requires transactions.delete.any). Each reversal is atomic on its
+// own, so one failure does not undo the others.
+// Returns count of reversed transactions and slice of errors
+func (s *TransactionService) BulkReverseTransactions(ids []string, reason string, principal *auth.Principal, actor Actor) (int, []map[string]string, error) {
+	reason, err := validateReason(reason)
 	if err != nil {
-		return fmt.Errorf("gagal menghapus transaksi: %w", err)
+		return 0, nil, err
 	}
 
-	// Rollback customer stats
-	_, err = s.db.Exec(
-		"UPDATE customers SET total_setoran = total_setoran - ?, updated_at = ? WHERE id = ?",
-		t.Nominal, time.Now(), t.CustomerID,
-	)
+	rules, err := s.approvals.Rules()
 	if err != nil {
-		return fmt.Errorf("gagal memperbarui statistik customer: %w", err)
+		return 0, nil, err
+	}
+	rule := ""
+	if rules.BulkDelete {
+		rule = RuleBulkDelete
+	}
+	// Otherwise the whole batch waits if any entry would on its own
+	for i := 0; rule == "" && i < len(ids); i++ {
+		if t, err := s.GetTransactionByID(ids[i]); err == nil {
+			rule = ReversalRule(rules, t)
+		}
+	}
+	if rule != "" {
+		summary := fmt.Sprintf("Batalkan %d transaksi: %s", len(ids), reason)
+		return 0, nil, s.approvals.Request(ApprovalBulkReverse, rule, summary, reversalPayload{IDs: ids, Reason: reason}, actor)
 	}
 
-	return nil
+	reversed, errors := s.bulkReverse(ids, reason, principal, actor)
+	return reversed, errors, nil
 }
 
-// BulkDeleteTransactions soft deletes multiple transactions (admin only)
-// Returns count of deleted transactions and slice of errors
-func (s *TransactionService) BulkDeleteTransactions(ids []string) (int, []map[string]string) {
-	var deleted int
+// bulkReverse reverses transactions one by one without approval checks
+func (s *TransactionService) bulkReverse(ids []string, reason string, principal *auth.Principal, actor Actor) (int, []map[string]string) {
+	var reversed int
 	var errors []map[string]string
 
 	for _, id := range ids {
-		// Get transaction details
-		var t models.Transaction
-		err := s.db.QueryRow(
-			"SELECT id, customer_id, nominal FROM transactions WHERE id = ? AND deleted_at IS NULL",
-			id,
-		).Scan(&t.ID, &t.CustomerID, &t.Nominal)
+		err := s.db.Transaction(func(tx *sql.Tx) error {
+			_, err := s.reverseTransactionTx(tx, id, reason, principal, actor)
+			return err
+		})
 		if err != nil {
 			errors = append(errors, map[string]string{
 				"id":    id,
-				"error": "transaksi tidak ditemukan",
+				"error": err.Error(),
 			})
 			continue
 		}
 
-		// Soft delete transaction
-		_, err = s.db.Exec(
-			"UPDATE transactions SET deleted_at = ? WHERE id = ?",
-			time.Now(), id,
-		)
+		reversed++
+	}
+
+	return reversed, errors
+}
+
+func (s *TransactionService) executeReverse(payload json.RawMessage, requester *auth.Principal, actor Actor) (interface{}, error) {
+	var p reversalPayload
+	if err := json.Unmarshal(payload, &p); err != nil || len(p.IDs) != 1 {
+		return nil, fmt.Errorf("payload permintaan tidak valid")
+	}
+	return s.reverseTransaction(p.IDs[0], p.Reason, requester, actor)
+}
+
+func (s *TransactionService) executeBulkReverse(payload json.RawMessage, requester *auth.Principal, actor Actor) (interface{}, error) {
+	var p reversalPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("payload permintaan tidak valid")
+	}
+
+	reversed, errors := s.bulkReverse(p.IDs, p.Reason, requester, actor)
+	if reversed == 0 && len(errors) > 0 {
+		return nil, fmt.Errorf("semua transaksi gagal dibatalkan")
+	}
+	result := map[string]interface{}{"reversed": reversed}
+	if len(errors) > 0 {
+		result["errors"] = errors
+	}
+	return result, nil
+}
+
+// validateReason checks the reason required for reversals and edits
+func validateReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return "", fmt.Errorf("alasan wajib diisi")
+	}
+	if len(reason) > 255 {
+		return "", fmt.Errorf("alasan maksimal 255 karakter")
+	}
+	return reason, nil
+}
+
+// reverseTransactionTx records the reversal of transaction id within tx. The
+// original is locked first, and the unique reverses_id index backs up the
+// already-reversed check against concurrent reversals.
+func (s *TransactionService) reverseTransactionTx(tx *sql.Tx, id, reason string, principal *auth.Principal, actor Actor) (*models.Transaction, error) {
+	var original models.Transaction
+	err := scanTransaction(tx.QueryRow(
+		"SELECT "+transactionColumns+" FROM transactions WHERE id = ? AND deleted_at IS NULL FOR UPDATE",
+		id,
+	), &original)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("transaksi tidak ditemukan")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if original.ReversesID != nil {
+		return nil, fmt.Errorf("entri pembatalan tidak dapat dibatalkan lagi")
+	}
+	if original.ReversalID != nil {
+		return nil, alreadyReversed(original.ID, *original.ReversalID)
+	}
+	// Tanpa izin hapus semua, user hanya bisa membatalkan transaksi miliknya sendiri
+	if !principal.Can(auth.PermTransactionsDeleteAny) && original.UserID != principal.UserID {
+		return nil, fmt.Errorf("anda hanya dapat membatalkan transaksi milik anda sendiri")
+	}
+	if err := checkPeriodOpen(tx, original.Timestamp); err != nil {
+		return nil, err
+	}
+
+	seq, err := database.NextSequence(tx, database.SeqTransactions)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Truncate(time.Second)
+	reversal := &models.Transaction{
+		ID:         utils.GenerateTXID(seq),
+		Timestamp:  now,
+		CustomerID: original.CustomerID,
+		Blok:       original.Blok,
+		Nama:       original.Nama,
+		Nominal:    -original.Nominal,
+		UserID:     original.UserID,
+		Petugas:    original.Petugas,
+		CreatedAt:  now,
+		ReversesID: &original.ID,
+		Reason:     &reason,
+		CreatedBy:  &principal.UserID,
+	}
+
+	// Update the customer first: customer rows are locked before the chain head
+	if err := addCustomerDeposit(tx, reversal.CustomerID, reversal.Nominal, now); err != nil {
+		return nil, fmt.Errorf("gagal memperbarui statistik customer: %w", err)
+	}
+
+	err = insertLedgerEntry(tx, reversal)
+	if database.IsDuplicateKey(err) {
+		return nil, alreadyReversed(original.ID, "")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gagal mencatat pembatalan: %w", err)
+	}
+
+	err = s.audit.RecordTx(tx, actor, AuditEntry{
+		Action:     AuditReverse,
+		EntityType: EntityTransaction,
+		EntityID:   original.ID,
+		Before:     &original,
+		After:      reversal,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reversal, nil
+}
+
+func alreadyReversed(id, reversalID string) error {
+	details := map[string]interface{}{"id": id}
+	if reversalID != "" {
+		details["reversal_id"] = reversalID
+	}
+	return &CodedError{
+		Code:    ErrCodeAlreadyReversed,
+		Message: fmt.Sprintf("transaksi %s sudah dibatalkan", id),
+		Details: details,
+	}
+}
+
+// UpdateTransaction corrects the customer, nominal or notes of a deposit.
+// The old and new values are stored as a revision, and the customers'
+// aggregates are adjusted in the same database transaction. The timestamp and
+// collector never change. Reversed entries and reversals cannot be edited.
+//
+// Changing the customer or nominal of an entry that matches the approval
+// rules for reversals, or raising it to the nominal threshold, is queued as
+// an approval request instead.
+func (s *TransactionService) UpdateTransaction(id string, req models.UpdateTransactionRequest, principal *auth.Principal, actor Actor) (*models.Transaction, error) {
+	if err := validateUpdate(req); err != nil {
+		return nil, err
+	}
+
+	if req.CustomerID != nil || req.Nominal != nil {
+		original, err := s.GetTransactionByID(id)
 		if err != nil {
-			errors = append(errors, map[string]string{
-				"id":    id,
-				"error": "gagal menghapus transaksi",
-			})
-			continue
+			return nil, err
 		}
 
-		// Rollback customer stats
-		_, err = s.db.Exec(
-			"UPDATE customers SET total_setoran = total_setoran - ?, updated_at = ? WHERE id = ?",
-			t.Nominal, time.Now(), t.CustomerID,
+		moved := req.CustomerID != nil && *req.CustomerID != original.CustomerID
+		resized := req.Nominal != nil && *req.Nominal != original.Nominal
+		if moved || resized {
+			if err := checkPeriodOpen(s.db, original.Timestamp); err != nil {
+				return nil, err
+			}
+
+			rules, err := s.approvals.Rules()
+			if err != nil {
+				return nil, err
+			}
+			rule := ReversalRule(rules, original)
+			if rule == "" && resized && rules.NominalThreshold > 0 && *req.Nominal >= rules.NominalThreshold {
+				rule = RuleNominal
+			}
+			if rule != "" {
+				summary := fmt.Sprintf("Ubah transaksi %s (%s, %s): %s", id, original.CustomerID, original.Nominal, strings.TrimSpace(req.Reason))
+				return nil, s.approvals.Request(ApprovalUpdateTransaction, rule, summary, updatePayload{ID: id, UpdateTransactionRequest: req}, actor)
+			}
+		}
+	}
+
+	return s.updateTransaction(id, req, principal, actor)
+}
+
+// validateUpdate checks an edit request before anything is read
+func validateUpdate(req models.UpdateTransactionRequest) error {
+	if _, err := validateReason(req.Reason); err != nil {
+		return err
+	}
+	if req.CustomerID == nil && req.Nominal == nil && req.Notes == nil {
+		return fmt.Errorf("setidaknya satu field harus diubah")
+	}
+	if req.Nominal != nil && *req.Nominal <= 0 {
+		return fmt.Errorf("nominal harus lebih dari 0")
+	}
+	return nil
+}
+
+func (s *TransactionService) executeUpdate(payload json.RawMessage, requester *auth.Principal, actor Actor) (interface{}, error) {
+	var p updatePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("payload permintaan tidak valid")
+	}
+	return s.updateTransaction(p.ID, p.UpdateTransactionRequest, requester, actor)
+}
+
+// updateTransaction applies an edit without approval checks
+func (s *TransactionService) updateTransaction(id string, req models.UpdateTransactionRequest, principal *auth.Principal, actor Actor) (*models.Transaction, error) {
+	if err := validateUpdate(req); err != nil {
+		return nil, err
+	}
+	reason := strings.TrimSpace(req.Reason)
+
+	var notes *string
+	if req.Notes != nil {
+		if trimmed := strings.TrimSpace(*req.Notes); trimmed != "" {
+			if len(trimmed) > 255 {
+				return nil, fmt.Errorf("catatan maksimal 255 karakter")
+			}
+			notes = &trimmed
+		}
+	}
+
+	var updated models.Transaction
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		var original models.Transaction
+		err := scanTransaction(tx.QueryRow(
+			"SELECT "+transactionColumns+" FROM transactions WHERE id = ? AND deleted_at IS NULL FOR UPDATE",
+			id,
+		), &original)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("transaksi tidak ditemukan")
+		}
+		if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		if original.ReversesID != nil {
+			return fmt.Errorf("entri pembatalan tidak dapat diubah")
+		}
+		if original.ReversalID != nil {
+			return fmt.Errorf("transaksi yang sudah dibatalkan tidak dapat diubah")
+		}
+		if err := checkPeriodOpen(tx, original.Timestamp); err != nil {
+			return err
+		}
+
+		updated = original
+		if req.Nominal != nil {
+			updated.Nominal = *req.Nominal
+		}
+		if req.Notes != nil {
+			updated.Notes = notes
+		}
+
+		moved := req.CustomerID != nil && *req.CustomerID != original.CustomerID
+		if moved {
+			if err := lockCustomersForMove(tx, original.CustomerID, *req.CustomerID, &updated); err != nil {
+				return err
+			}
+		}
+
+		if !moved && updated.Nominal == original.Nominal && sameNotes(updated.Notes, original.Notes) {
+			return fmt.Errorf("tidak ada perubahan")
+		}
+
+		_, err = tx.Exec(
+			"UPDATE transactions SET customer_id = ?, blok = ?, nama = ?, nominal = ?, notes = ? WHERE id = ?",
+			updated.CustomerID, updated.Blok, updated.Nama, updated.Nominal, updated.Notes, id,
 		)
 		if err != nil {
-			errors = append(errors, map[string]string{
-				"id":    id,
-				"error": "gagal memperbarui statistik customer",
-			})
-			continue
+			return fmt.Errorf("gagal mengubah transaksi: %w", err)
 		}
 
-		deleted++
+		if moved {
+			if err := removeCustomerDeposit(tx, original.CustomerID, original.Nominal); err != nil {
+				return fmt.Errorf("gagal memperbarui statistik customer: %w", err)
+			}
+			if err := addCustomerDeposit(tx, updated.CustomerID, updated.Nominal, updated.Timestamp); err != nil {
+				return fmt.Errorf("gagal memperbarui statistik customer: %w", err)
+			}
+		} else if updated.Nominal != original.Nominal {
+			if err := addCustomerDeposit(tx, updated.CustomerID, updated.Nominal-original.Nominal, updated.Timestamp); err != nil {
+				return fmt.Errorf("gagal memperbarui statistik customer: %w", err)
+			}
+		}
+
+		// Chained last, after every customer row it touches is locked
+		err = insertRevision(tx, &models.TransactionRevision{
+			TransactionID: id,
+			OldCustomerID: original.CustomerID,
+			NewCustomerID: updated.CustomerID,
+			OldBlok:       original.Blok,
+			NewBlok:       updated.Blok,
+			OldNama:       original.Nama,
+			NewNama:       updated.Nama,
+			OldNominal:    original.Nominal,
+			NewNominal:    updated.Nominal,
+			OldNotes:      original.Notes,
+			NewNotes:      updated.Notes,
+			Reason:        reason,
+			EditedBy:      principal.UserID,
+			CreatedAt:     time.Now().Truncate(time.Second),
+		})
+		if err != nil {
+			return fmt.Errorf("gagal menyimpan revisi: %w", err)
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditUpdate,
+			EntityType: EntityTransaction,
+			EntityID:   id,
+			Before:     &original,
+			After:      &updated,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// lockCustomersForMove locks both customers of a transaction that moves
+// between them, in ID order so concurrent moves cannot deadlock, and fills
+// t's customer fields from the new one, which must be active
+func lockCustomersForMove(tx *sql.Tx, fromID, toID string, t *models.Transaction) error {
+	ids := []string{fromID, toID}
+	if toID < fromID {
+		ids = []string{toID, fromID}
+	}
+
+	for _, customerID := range ids {
+		var c models.Customer
+		err := tx.QueryRow(
+			"SELECT id, blok, nama, deleted_at FROM customers WHERE id = ? FOR UPDATE",
+			customerID,
+		).Scan(&c.ID, &c.Blok, &c.Nama, &c.DeletedAt)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		if customerID == toID {
+			if err == sql.ErrNoRows || c.DeletedAt != nil {
+				return fmt.Errorf("customer tidak ditemukan")
+			}
+			t.CustomerID, t.Blok, t.Nama = c.ID, c.Blok, c.Nama
+		}
+	}
+
+	return nil
+}
+
+func sameNotes(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// GetTransactionRevisions returns the edits of a transaction, oldest first.
+// Without transactions.read, principal may only see their own transactions.
+func (s *TransactionService) GetTransactionRevisions(id string, principal *auth.Principal) ([]models.TransactionRevision, error) {
+	var ownerID string
+	err := s.db.QueryRow("SELECT user_id FROM transactions WHERE id = ?", id).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("transaksi tidak ditemukan")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if !principal.Can(auth.PermTransactionsRead) && ownerID != principal.UserID {
+		return nil, fmt.Errorf("anda hanya dapat melihat transaksi milik anda sendiri")
+	}
+
+	rows, err := s.db.Query("SELECT "+revisionColumns+" FROM transaction_revisions WHERE transaction_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []models.TransactionRevision{}
+	for rows.Next() {
+		var r models.TransactionRevision
+		if err := scanRevision(rows, &r); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, r)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetDeletedTransactions returns soft-deleted transactions, most recently deleted first
+func (s *TransactionService) GetDeletedTransactions() ([]models.Transaction, error) {
+	rows, err := s.db.Query(
+		"SELECT " + transactionColumns + ", deleted_at FROM transactions WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	transactions := []models.Transaction{}
+	for rows.Next() {
+		var t models.Transaction
+		err := scanTransaction(rows, &t, &t.DeletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		transactions = append(transactions, t)
 	}
 
-	return deleted, errors
+	return transactions, rows.Err()
+}
+
+// RestoreTransaction undoes a soft delete and puts the nominal back on the
+// customer's balance, and chains the restore. It is refused while the
+// customer is deleted; restore the customer first. Locks are taken in the
+// same order as deletes.
+func (s *TransactionService) RestoreTransaction(id string, actor Actor) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		var t models.Transaction
+		err := scanTransaction(tx.QueryRow(
+			"SELECT "+transactionColumns+", deleted_at FROM transactions WHERE id = ? AND deleted_at IS NOT NULL FOR UPDATE",
+			id,
+		), &t, &t.DeletedAt)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("transaksi tidak ditemukan di tempat sampah")
+		}
+		if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if err := checkPeriodOpen(tx, t.Timestamp); err != nil {
+			return err
+		}
+
+		var customerID string
+		err = tx.QueryRow("SELECT id FROM customers WHERE id = ? AND deleted_at IS NULL FOR UPDATE", t.CustomerID).Scan(&customerID)
+		if err == sql.ErrNoRows {
+			return &CodedError{
+				Code:    ErrCodeRestoreConflict,
+				Message: "customer transaksi ini sudah dihapus, pulihkan customer terlebih dahulu",
+				Details: map[string]interface{}{"customer_id": t.CustomerID},
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		if _, err := tx.Exec("UPDATE transactions SET deleted_at = NULL WHERE id = ?", id); err != nil {
+			return fmt.Errorf("gagal memulihkan transaksi: %w", err)
+		}
+
+		if err := addCustomerDeposit(tx, t.CustomerID, t.Nominal, t.Timestamp); err != nil {
+			return fmt.Errorf("gagal memperbarui statistik customer: %w", err)
+		}
+
+		var restoredBy *string
+		if actor.UserID != "" {
+			restoredBy = &actor.UserID
+		}
+		if err := insertDeletion(tx, id, false, restoredBy, time.Now()); err != nil {
+			return fmt.Errorf("gagal mencatat pemulihan di rantai ledger: %w", err)
+		}
+
+		restored := t
+		restored.DeletedAt = nil
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditRestore,
+			EntityType: EntityTransaction,
+			EntityID:   id,
+			Before:     &t,
+			After:      &restored,
+		})
+	})
 }
 
 // GetTransactionByID returns transaction by ID
 func (s *TransactionService) GetTransactionByID(id string) (*models.Transaction, error) {
 	var t models.Transaction
-	err := s.db.QueryRow(
-		"SELECT id, timestamp, customer_id, blok, nama, nominal, user_id, petugas, created_at FROM transactions WHERE id = ? AND deleted_at IS NULL",
+	err := scanTransaction(s.db.QueryRow(
+		"SELECT "+transactionColumns+" FROM transactions WHERE id = ? AND deleted_at IS NULL",
 		id,
-	).Scan(&t.ID, &t.Timestamp, &t.CustomerID, &t.Blok, &t.Nama, &t.Nominal, &t.UserID, &t.Petugas, &t.CreatedAt)
+	), &t)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("transaction tidak ditemukan")
@@ -0,0 +1,385 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"jimpitan/backend/internal/config"
+	"jimpitan/backend/internal/database"
+	"jimpitan/backend/internal/models"
+	"jimpitan/backend/internal/utils"
+	"time"
+)
+
+// Login challenge purposes
+const (
+	ChallengeTOTP   = "totp"
+	ChallengeEnroll = "enroll"
+)
+
+const (
+	challengeTTL         = 5 * time.Minute
+	challengeMaxAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+type TwoFactorService struct {
+	db            *database.DB
+	audit         *AuditService
+	issuer        string
+	requiredRoles map[string]bool
+}
+
+func NewTwoFactorService(db *database.DB, cfg *config.TwoFactorConfig, audit *AuditService) *TwoFactorService {
+	required := make(map[string]bool)
+	for _, role := range cfg.RequiredRoles {
+		required[role] = true
+	}
+
+	return &TwoFactorService{
+		db:            db,
+		audit:         audit,
+		issuer:        cfg.Issuer,
+		requiredRoles: required,
+	}
+}
+
+// IsRequired reports whether policy forces users with role to use 2FA
+func (s *TwoFactorService) IsRequired(role string) bool {
+	return s.requiredRoles[role]
+}
+
+// BeginSetup generates a new pending TOTP secret for a user who has not
+// enabled 2FA yet. It only becomes active after Enable confirms a code.
+func (s *TwoFactorService) BeginSetup(userID string) (*models.TwoFactorSetup, error) {
+	var username string
+	var enabled bool
+	err := s.db.QueryRow(
+		"SELECT username, totp_enabled FROM users WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	).Scan(&username, &enabled)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user tidak ditemukan")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if enabled {
+		return nil, fmt.Errorf("verifikasi dua langkah sudah aktif")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(
+		"UPDATE users SET totp_secret = ?, totp_last_step = NULL, updated_at = ? WHERE id = ?",
+		secret, time.Now(), userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+
+	return &models.TwoFactorSetup{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(s.issuer, username, secret),
+	}, nil
+}
+
+// Enable confirms the pending secret with a code from the authenticator app,
+// turns 2FA on and returns a fresh set of recovery codes
+func (s *TwoFactorService) Enable(userID, code string, actor Actor) ([]string, error) {
+	var codes []string
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		secret, enabled, err := loadSecret(tx, userID, true)
+		if err != nil {
+			return err
+		}
+
+		if enabled {
+			return fmt.Errorf("verifikasi dua langkah sudah aktif")
+		}
+		if secret == "" {
+			return fmt.Errorf("mulai pengaturan verifikasi dua langkah terlebih dahulu")
+		}
+
+		if err := verifyTOTP(tx, userID, secret, code); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("UPDATE users SET totp_enabled = true, updated_at = ? WHERE id = ?", time.Now(), userID); err != nil {
+			return fmt.Errorf("failed to enable 2FA: %w", err)
+		}
+
+		if codes, err = replaceRecoveryCodes(tx, userID); err != nil {
+			return err
+		}
+
+		// Recovery codes are never audited, only how many were issued
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditTwoFactorOn,
+			EntityType: EntityUser,
+			EntityID:   userID,
+			Before:     map[string]interface{}{"totp_enabled": false},
+			After:      map[string]interface{}{"totp_enabled": true, "recovery_codes": len(codes)},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns 2FA off after checking the password and a current code.
+// Users whose role requires 2FA cannot disable it.
+func (s *TwoFactorService) Disable(userID, password, code string, actor Actor) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		var role, passwordHash string
+		err := tx.QueryRow(
+			"SELECT role, password_hash FROM users WHERE id = ? AND deleted_at IS NULL FOR UPDATE",
+			userID,
+		).Scan(&role, &passwordHash)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("user tidak ditemukan")
+		}
+		if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		if s.IsRequired(role) {
+			return fmt.Errorf("verifikasi dua langkah wajib untuk role %s", role)
+		}
+
+		if !utils.VerifyPassword(password, passwordHash) {
+			return fmt.Errorf("password tidak sesuai")
+		}
+
+		if err := verifyLoginCode(tx, userID, code, ""); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			"UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_step = NULL, updated_at = ? WHERE id = ?",
+			time.Now(), userID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to disable 2FA: %w", err)
+		}
+
+		if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditTwoFactorOff,
+			EntityType: EntityUser,
+			EntityID:   userID,
+			Before:     map[string]interface{}{"totp_enabled": true},
+			After:      map[string]interface{}{"totp_enabled": false},
+		})
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current code
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID, code string, actor Actor) ([]string, error) {
+	var codes []string
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		if err := verifyLoginCode(tx, userID, code, ""); err != nil {
+			return err
+		}
+
+		var err error
+		if codes, err = replaceRecoveryCodes(tx, userID); err != nil {
+			return err
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditRecoveryCodes,
+			EntityType: EntityUser,
+			EntityID:   userID,
+			After:      map[string]interface{}{"recovery_codes": len(codes)},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyLoginCode checks either a TOTP code or a one-time recovery code for
+// a user with 2FA enabled. A recovery code is consumed on success.
+func (s *TwoFactorService) VerifyLoginCode(userID, code, recoveryCode string) error {
+	return verifyLoginCode(s.db, userID, code, recoveryCode)
+}
+
+// verifyLoginCode is VerifyLoginCode through q. Inside a transaction a code
+// consumed by a change that rolls back can be used again.
+func verifyLoginCode(q database.Querier, userID, code, recoveryCode string) error {
+	secret, enabled, err := loadSecret(q, userID, false)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return fmt.Errorf("verifikasi dua langkah belum aktif")
+	}
+
+	if recoveryCode != "" {
+		return consumeRecoveryCode(q, userID, recoveryCode)
+	}
+
+	return verifyTOTP(q, userID, secret, code)
+}
+
+// CreateChallenge opens a pending second login step for a user
+func (s *TwoFactorService) CreateChallenge(userID, purpose string) (*models.TwoFactorChallenge, error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(challengeTTL)
+
+	// Only the newest challenge of a user stays valid
+	if _, err := s.db.Exec("DELETE FROM login_challenges WHERE user_id = ? OR expires_at <= ?", userID, now); err != nil {
+		return nil, fmt.Errorf("failed to clean up login challenges: %w", err)
+	}
+
+	_, err = s.db.Exec(
+		"INSERT INTO login_challenges (id, user_id, purpose, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		utils.HashToken(token), userID, purpose, expiresAt, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login challenge: %w", err)
+	}
+
+	return &models.TwoFactorChallenge{
+		Token:     token,
+		Type:      purpose,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// LookupChallenge returns the user and purpose of a valid challenge
+func (s *TwoFactorService) LookupChallenge(token string) (string, string, error) {
+	if token == "" {
+		return "", "", fmt.Errorf("challenge_token harus diisi")
+	}
+
+	var userID, purpose string
+	var attempts int
+	var expiresAt time.Time
+	err := s.db.QueryRow(
+		"SELECT user_id, purpose, attempts, expires_at FROM login_challenges WHERE id = ?",
+		utils.HashToken(token),
+	).Scan(&userID, &purpose, &attempts, &expiresAt)
+
+	if err == sql.ErrNoRows {
+		return "", "", fmt.Errorf("sesi verifikasi tidak valid, silakan login kembali")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("database error: %w", err)
+	}
+
+	if time.Now().After(expiresAt) || attempts >= challengeMaxAttempts {
+		s.DeleteChallenge(token)
+		return "", "", fmt.Errorf("sesi verifikasi sudah berakhir, silakan login kembali")
+	}
+
+	return userID, purpose, nil
+}
+
+// FailChallenge counts a wrong code against a challenge
+func (s *TwoFactorService) FailChallenge(token string) {
+	_, _ = s.db.Exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE id = ?", utils.HashToken(token))
+}
+
+// DeleteChallenge removes a completed or abandoned challenge
+func (s *TwoFactorService) DeleteChallenge(token string) {
+	_, _ = s.db.Exec("DELETE FROM login_challenges WHERE id = ?", utils.HashToken(token))
+}
+
+// loadSecret reads the TOTP state of a user, locking the row when lock is set
+func loadSecret(q database.Querier, userID string, lock bool) (string, bool, error) {
+	query := "SELECT totp_secret, totp_enabled FROM users WHERE id = ? AND deleted_at IS NULL"
+	if lock {
+		query += " FOR UPDATE"
+	}
+
+	var secret sql.NullString
+	var enabled bool
+	err := q.QueryRow(query, userID).Scan(&secret, &enabled)
+
+	if err == sql.ErrNoRows {
+		return "", false, fmt.Errorf("user tidak ditemukan")
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("database error: %w", err)
+	}
+
+	return secret.String, enabled, nil
+}
+
+// verifyTOTP checks a code and records its time step so the same code cannot
+// be replayed within its validity window
+func verifyTOTP(exec database.Execer, userID, secret, code string) error {
+	step, ok := utils.VerifyTOTP(secret, code, time.Now())
+	if !ok {
+		return fmt.Errorf("kode verifikasi salah")
+	}
+
+	result, err := exec.Exec(
+		"UPDATE users SET totp_last_step = ? WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)",
+		step, userID, step,
+	)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return fmt.Errorf("kode verifikasi sudah digunakan, tunggu kode berikutnya")
+	}
+
+	return nil
+}
+
+func consumeRecoveryCode(exec database.Execer, userID, code string) error {
+	result, err := exec.Exec(
+		"UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now(), userID, utils.HashToken(utils.NormalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return fmt.Errorf("kode pemulihan salah atau sudah digunakan")
+	}
+	return nil
+}
+
+// replaceRecoveryCodes deletes the old recovery codes of a user and stores
+// new ones as part of tx
+func replaceRecoveryCodes(tx *sql.Tx, userID string) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, fmt.Errorf("failed to replace recovery codes: %w", err)
+	}
+
+	now := time.Now()
+	for _, code := range codes {
+		_, err := tx.Exec(
+			"INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)",
+			userID, utils.HashToken(utils.NormalizeRecoveryCode(code)), now,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+		}
+	}
+
+	return codes, nil
+}
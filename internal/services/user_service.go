@@ -2,7 +2,10 @@ package services
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"jimpitan/backend/internal/auth"
 	"jimpitan/backend/internal/database"
 	"jimpitan/backend/internal/models"
 	"jimpitan/backend/internal/utils"
@@ -10,11 +13,42 @@ import (
 )
 
 type UserService struct {
-	db *database.DB
+	db        *database.DB
+	sessions  *SessionService
+	throttle  *LoginThrottleService
+	audit     *AuditService
+	approvals *ApprovalService
 }
 
-func NewUserService(db *database.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *database.DB, sessions *SessionService, throttle *LoginThrottleService, audit *AuditService, approvals *ApprovalService) *UserService {
+	s := &UserService{db: db, sessions: sessions, throttle: throttle, audit: audit, approvals: approvals}
+	approvals.Register(ApprovalCreateUser, s.executeCreate, auth.PermUsersWrite)
+	approvals.Register(ApprovalRoleChange, s.executeUpdate, auth.PermUsersWrite)
+	approvals.Register(ApprovalBulkDeleteUsers, s.executeBulkDelete, auth.PermUsersWrite)
+	return s
+}
+
+// userCreatePayload is the approval payload of creating a user with a
+// privileged role. Only the password hash is stored, and it is left out of
+// the request when encoded.
+type userCreatePayload struct {
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+}
+
+// userUpdatePayload is the approval payload of a user update that changes the role
+type userUpdatePayload struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Role     string `json:"role"`
+	Username string `json:"username,omitempty"`
+}
+
+// userIDsPayload is the approval payload of a bulk user delete
+type userIDsPayload struct {
+	IDs []string `json:"ids"`
 }
 
 // GetAllUsers returns all active users
@@ -58,14 +92,15 @@ func (s *UserService) GetUserByID(id string) (*models.User, error) {
 	return &u, nil
 }
 
-// CreateUser creates a new user
-func (s *UserService) CreateUser(name, role, username, password string) (*models.User, error) {
+// CreateUser creates a new user. With the role change rule on, creating a
+// user with a privileged role needs approval.
+func (s *UserService) CreateUser(name, role, username, password string, actor Actor) (*models.User, error) {
 	if name == "" || role == "" || username == "" || password == "" {
 		return nil, fmt.Errorf("semua field harus diisi")
 	}
 
-	if role != "admin" && role != "petugas" {
-		return nil, fmt.Errorf("role harus 'admin' atau 'petugas'")
+	if !auth.IsValidRole(role) {
+		return nil, fmt.Errorf("role harus salah satu dari %s", auth.RoleList())
 	}
 
 	// Check if username already exists
@@ -75,70 +110,162 @@ func (s *UserService) CreateUser(name, role, username, password string) (*models
 		return nil, fmt.Errorf("username sudah terdaftar")
 	}
 
-	// Get next user number
-	var count int
-	err = s.db.QueryRow("SELECT COUNT(*) FROM users WHERE deleted_at IS NULL").Scan(&count)
+	passwordHash, err := utils.HashPassword(password)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user count: %w", err)
+		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	userID := utils.GenerateUserID(count)
-	passwordHash := utils.HashPassword(password)
-	now := time.Now()
-
-	_, err = s.db.Exec(
-		"INSERT INTO users (id, name, role, username, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		userID, name, role, username, passwordHash, now, now,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+	if auth.IsPrivilegedRole(role) {
+		rules, err := s.approvals.Rules()
+		if err != nil {
+			return nil, err
+		}
+		if rules.RoleChange {
+			summary := fmt.Sprintf("Buat user %s dengan role %s", username, role)
+			payload := userCreatePayload{Name: name, Role: role, Username: username, PasswordHash: passwordHash}
+			return nil, s.approvals.Request(ApprovalCreateUser, RuleRoleChange, summary, payload, actor)
+		}
 	}
 
-	return &models.User{
-		ID:        userID,
+	return s.createUser(name, role, username, passwordHash, actor)
+}
+
+// createUser creates a user without approval checks
+func (s *UserService) createUser(name, role, username, passwordHash string, actor Actor) (*models.User, error) {
+	now := time.Now()
+
+	user := &models.User{
 		Name:      name,
 		Role:      role,
 		Username:  username,
 		CreatedAt: now,
 		UpdatedAt: now,
-	}, nil
+	}
+
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		seq, err := database.NextSequence(tx, database.SeqUsers)
+		if err != nil {
+			return err
+		}
+		user.ID = utils.GenerateUserID(seq)
+
+		_, err = tx.Exec(
+			"INSERT INTO users (id, name, role, username, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			user.ID, name, role, username, passwordHash, now, now,
+		)
+		if database.IsDuplicateKey(err) {
+			return fmt.Errorf("username sudah terdaftar")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditCreate,
+			EntityType: EntityUser,
+			EntityID:   user.ID,
+			After:      user,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
 }
 
 // UpdateUser updates user data
-func (s *UserService) UpdateUser(id, name, role, username string) error {
+func (s *UserService) UpdateUser(id, name, role, username string, actor Actor) error {
 	if name == "" && role == "" && username == "" {
 		return fmt.Errorf("setidaknya satu field harus diubah")
 	}
 
-	if role != "" && role != "admin" && role != "petugas" {
-		return fmt.Errorf("role harus 'admin' atau 'petugas'")
+	if role != "" && !auth.IsValidRole(role) {
+		return fmt.Errorf("role harus salah satu dari %s", auth.RoleList())
 	}
 
-	query := "UPDATE users SET "
-	args := []interface{}{}
-
-	if name != "" {
-		query += "name = ?, "
-		args = append(args, name)
-	}
 	if role != "" {
-		query += "role = ?, "
-		args = append(args, role)
+		current, err := s.GetUserByID(id)
+		if err != nil {
+			return err
+		}
+
+		rules, err := s.approvals.Rules()
+		if err != nil {
+			return err
+		}
+		if rules.RoleChange && current.Role != role {
+			summary := fmt.Sprintf("Ubah role %s (%s) dari %s menjadi %s", current.Username, id, current.Role, role)
+			return s.approvals.Request(ApprovalRoleChange, RuleRoleChange, summary, userUpdatePayload{ID: id, Name: name, Role: role, Username: username}, actor)
+		}
 	}
-	if username != "" {
-		query += "username = ?, "
-		args = append(args, username)
+
+	return s.updateUser(id, name, role, username, actor)
+}
+
+// updateUser updates a user without approval checks
+func (s *UserService) updateUser(id, name, role, username string, actor Actor) error {
+	var roleChanged bool
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		before, err := lockUser(tx, id, false)
+		if err != nil {
+			return err
+		}
+
+		query := "UPDATE users SET "
+		args := []interface{}{}
+		after := *before
+
+		if name != "" {
+			query += "name = ?, "
+			args = append(args, name)
+			after.Name = name
+		}
+		if role != "" {
+			query += "role = ?, "
+			args = append(args, role)
+			after.Role = role
+		}
+		if username != "" {
+			query += "username = ?, "
+			args = append(args, username)
+			after.Username = username
+		}
+
+		after.UpdatedAt = time.Now()
+		query += "updated_at = ? WHERE id = ?"
+		args = append(args, after.UpdatedAt, id)
+
+		if _, err := tx.Exec(query, args...); err != nil {
+			if database.IsDuplicateKey(err) {
+				return fmt.Errorf("username sudah terdaftar")
+			}
+			return err
+		}
+
+		roleChanged = after.Role != before.Role
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditUpdate,
+			EntityType: EntityUser,
+			EntityID:   id,
+			Before:     before,
+			After:      &after,
+		})
+	})
+	if err != nil {
+		return err
 	}
 
-	query += "updated_at = ? WHERE id = ? AND deleted_at IS NULL"
-	args = append(args, time.Now(), id)
+	// Tokens carry the role, so a role change must invalidate them
+	if roleChanged {
+		return s.sessions.RevokeUserTokens(id)
+	}
 
-	_, err := s.db.Exec(query, args...)
-	return err
+	return nil
 }
 
 // UpdatePassword updates user password
-func (s *UserService) UpdatePassword(id, oldPassword, newPassword string) error {
+func (s *UserService) UpdatePassword(id, oldPassword, newPassword string, actor Actor) error {
 	var passwordHash string
 	err := s.db.QueryRow("SELECT password_hash FROM users WHERE id = ? AND deleted_at IS NULL", id).Scan(&passwordHash)
 	if err != nil {
@@ -149,49 +276,258 @@ func (s *UserService) UpdatePassword(id, oldPassword, newPassword string) error
 		return fmt.Errorf("password lama tidak sesuai")
 	}
 
-	newHash := utils.HashPassword(newPassword)
-	_, err = s.db.Exec(
-		"UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?",
-		newHash, time.Now(), id,
-	)
-	return err
+	newHash, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			"UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?",
+			newHash, time.Now(), id,
+		)
+		if err != nil {
+			return err
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditPasswordChange,
+			EntityType: EntityUser,
+			EntityID:   id,
+		})
+	})
 }
 
-// DeleteUser soft deletes a user
-func (s *UserService) DeleteUser(id string) error {
-	_, err := s.db.Exec(
-		"UPDATE users SET deleted_at = ? WHERE id = ?",
-		time.Now(), id,
-	)
-	return err
+// DeleteUser soft deletes a user and revokes every token they hold
+func (s *UserService) DeleteUser(id string, actor Actor) error {
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		return s.deleteUserTx(tx, id, actor)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.sessions.RevokeUserTokens(id)
 }
 
-// BulkDeleteUsers soft deletes multiple users
-func (s *UserService) BulkDeleteUsers(ids []string) error {
+// BulkDeleteUsers soft deletes multiple users and returns how many were
+// deleted. Unknown or already deleted IDs are skipped.
+func (s *UserService) BulkDeleteUsers(ids []string, actor Actor) (int, error) {
 	if len(ids) == 0 {
-		return fmt.Errorf("tidak ada user untuk dihapus")
+		return 0, fmt.Errorf("tidak ada user untuk dihapus")
+	}
+
+	rules, err := s.approvals.Rules()
+	if err != nil {
+		return 0, err
+	}
+	if rules.BulkDelete {
+		summary := fmt.Sprintf("Hapus %d user", len(ids))
+		return 0, s.approvals.Request(ApprovalBulkDeleteUsers, RuleBulkDelete, summary, userIDsPayload{IDs: ids}, actor)
+	}
+
+	return s.bulkDelete(ids, actor)
+}
+
+// bulkDelete soft deletes users without approval checks and returns how
+// many were deleted
+func (s *UserService) bulkDelete(ids []string, actor Actor) (int, error) {
+	var deleted []string
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			err := s.deleteUserTx(tx, id, actor)
+			if errors.Is(err, errUserNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			deleted = append(deleted, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	// Build placeholders
-	query := "UPDATE users SET deleted_at = ? WHERE id IN ("
-	args := []interface{}{time.Now()}
-	for i := 0; i < len(ids); i++ {
-		if i > 0 {
-			query += ", "
+	for _, id := range deleted {
+		if err := s.sessions.RevokeUserTokens(id); err != nil {
+			return 0, err
 		}
-		query += "?"
-		args = append(args, ids[i])
 	}
-	query += ")"
 
-	_, err := s.db.Exec(query, args...)
-	return err
+	return len(deleted), nil
+}
+
+func (s *UserService) executeCreate(payload json.RawMessage, requester *auth.Principal, actor Actor) (interface{}, error) {
+	var p userCreatePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("payload permintaan tidak valid")
+	}
+	return s.createUser(p.Name, p.Role, p.Username, p.PasswordHash, actor)
+}
+
+func (s *UserService) executeUpdate(payload json.RawMessage, requester *auth.Principal, actor Actor) (interface{}, error) {
+	var p userUpdatePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("payload permintaan tidak valid")
+	}
+	if err := s.updateUser(p.ID, p.Name, p.Role, p.Username, actor); err != nil {
+		return nil, err
+	}
+	return s.GetUserByID(p.ID)
+}
+
+func (s *UserService) executeBulkDelete(payload json.RawMessage, requester *auth.Principal, actor Actor) (interface{}, error) {
+	var p userIDsPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("payload permintaan tidak valid")
+	}
+	deleted, err := s.bulkDelete(p.IDs, actor)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"deleted_count": deleted}, nil
+}
+
+// deleteUserTx soft deletes an active user within tx and audits it
+func (s *UserService) deleteUserTx(tx *sql.Tx, id string, actor Actor) error {
+	before, err := lockUser(tx, id, false)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET deleted_at = ? WHERE id = ?", time.Now(), id); err != nil {
+		return err
+	}
+
+	return s.audit.RecordTx(tx, actor, AuditEntry{
+		Action:     AuditDelete,
+		EntityType: EntityUser,
+		EntityID:   id,
+		Before:     before,
+	})
+}
+
+var errUserNotFound = errors.New("user tidak ditemukan")
+
+// lockUser reads an active (or, with deleted set, a soft-deleted) user for
+// an audited change and locks the row
+func lockUser(tx *sql.Tx, id string, deleted bool) (*models.User, error) {
+	query := "SELECT id, name, role, username, created_at, updated_at, last_login, deleted_at FROM users WHERE id = ? AND deleted_at IS NULL FOR UPDATE"
+	if deleted {
+		query = "SELECT id, name, role, username, created_at, updated_at, last_login, deleted_at FROM users WHERE id = ? AND deleted_at IS NOT NULL FOR UPDATE"
+	}
+
+	var u models.User
+	err := tx.QueryRow(query, id).Scan(&u.ID, &u.Name, &u.Role, &u.Username, &u.CreatedAt, &u.UpdatedAt, &u.LastLogin, &u.DeletedAt)
+	if err == sql.ErrNoRows {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &u, nil
+}
+
+// GetDeletedUsers returns soft-deleted users, most recently deleted first
+func (s *UserService) GetDeletedUsers() ([]models.User, error) {
+	rows, err := s.db.Query(
+		"SELECT id, name, role, username, created_at, updated_at, last_login, deleted_at FROM users WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Role, &u.Username, &u.CreatedAt, &u.UpdatedAt, &u.LastLogin, &u.DeletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// RestoreUser undoes a soft delete. It is refused when an active user has
+// taken the username in the meantime. Tokens revoked by the delete stay
+// revoked, so the user signs in again.
+func (s *UserService) RestoreUser(id string, actor Actor) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		before, err := lockUser(tx, id, true)
+		if errors.Is(err, errUserNotFound) {
+			return fmt.Errorf("user tidak ditemukan di tempat sampah")
+		}
+		if err != nil {
+			return err
+		}
+		username := before.Username
+
+		conflict := &CodedError{
+			Code:    ErrCodeRestoreConflict,
+			Message: fmt.Sprintf("username %s sudah dipakai user aktif lain", username),
+			Details: map[string]interface{}{"username": username},
+		}
+
+		var existingID string
+		err = tx.QueryRow("SELECT id FROM users WHERE username = ? AND deleted_at IS NULL", username).Scan(&existingID)
+		if err == nil {
+			conflict.Details["user_id"] = existingID
+			return conflict
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		after := *before
+		after.DeletedAt = nil
+		after.UpdatedAt = time.Now()
+
+		// The unique index on active usernames catches a concurrent create
+		if _, err := tx.Exec("UPDATE users SET deleted_at = NULL, updated_at = ? WHERE id = ?", after.UpdatedAt, id); err != nil {
+			if database.IsDuplicateKey(err) {
+				return conflict
+			}
+			return fmt.Errorf("gagal memulihkan user: %w", err)
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditRestore,
+			EntityType: EntityUser,
+			EntityID:   id,
+			Before:     before,
+			After:      &after,
+		})
+	})
+}
+
+// UnlockUser lifts a login lockout on the user's account
+func (s *UserService) UnlockUser(id string, actor Actor) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		user, err := lockUser(tx, id, false)
+		if err != nil {
+			return err
+		}
+
+		if err := s.throttle.UnlockUserTx(tx, id, user.Username, actor.UserID); err != nil {
+			return err
+		}
+
+		return s.audit.RecordTx(tx, actor, AuditEntry{
+			Action:     AuditUnlock,
+			EntityType: EntityUser,
+			EntityID:   id,
+		})
+	})
 }
 
 // GetUserActivity returns all transactions for a user
 func (s *UserService) GetUserActivity(userID string) ([]models.Transaction, error) {
 	rows, err := s.db.Query(
-		"SELECT id, timestamp, customer_id, blok, nama, nominal, user_id, petugas, created_at FROM transactions WHERE user_id = ? AND deleted_at IS NULL ORDER BY timestamp DESC",
+		"SELECT "+transactionColumns+" FROM transactions WHERE user_id = ? AND deleted_at IS NULL ORDER BY timestamp DESC",
 		userID,
 	)
 	if err != nil {
@@ -202,7 +538,7 @@ func (s *UserService) GetUserActivity(userID string) ([]models.Transaction, erro
 	var transactions []models.Transaction
 	for rows.Next() {
 		var t models.Transaction
-		err := rows.Scan(&t.ID, &t.Timestamp, &t.CustomerID, &t.Blok, &t.Nama, &t.Nominal, &t.UserID, &t.Petugas, &t.CreatedAt)
+		err := scanTransaction(rows, &t)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan transaction: %w", err)
 		}
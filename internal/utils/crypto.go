@@ -1,25 +1,117 @@
 package utils
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"math/rand"
+	mathrand "math/rand"
+	"strings"
 	"time"
+
+	"golang.org/x/crypto/argon2"
 )
 
 func init() {
-	rand.Seed(time.Now().UnixNano())
+	mathrand.Seed(time.Now().UnixNano())
 }
 
-// HashPassword hashes a password using SHA-256
-func HashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return fmt.Sprintf("%x", hash)
+// Argon2id parameters used for new password hashes. They are encoded into
+// every hash, so they can be raised later without breaking existing users.
+const (
+	argon2Time    uint32 = 3
+	argon2Memory  uint32 = 64 * 1024
+	argon2Threads uint8  = 2
+	argon2KeyLen  uint32 = 32
+	argon2SaltLen        = 16
+)
+
+// HashPassword hashes a password using argon2id with a random per-user salt.
+// The result uses the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		argon2Memory,
+		argon2Time,
+		argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
 }
 
-// VerifyPassword verifies password against hash
+// VerifyPassword verifies password against an argon2id hash, or against a
+// legacy unsalted SHA-256 hex digest
 func VerifyPassword(password, hash string) bool {
-	return HashPassword(password) == hash
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return verifyArgon2id(password, hash)
+	}
+
+	// Legacy SHA-256 hash
+	digest := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(digest[:])), []byte(strings.ToLower(hash))) == 1
+}
+
+// PasswordNeedsRehash reports whether hash is not an argon2id hash with the
+// current parameters and should be replaced after a successful login
+func PasswordNeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params != fmt.Sprintf("m=%d,t=%d,p=%d", argon2Memory, argon2Time, argon2Threads)
+}
+
+func verifyArgon2id(password, hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(params, "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1
+}
+
+// decodeArgon2id splits an encoded argon2id hash into its parameter string,
+// salt and derived key
+func decodeArgon2id(hash string) (string, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return "", nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return "", nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+
+	return parts[3], salt, key, nil
 }
 
 // GenerateToken generates a 32-character random token
@@ -27,11 +119,28 @@ func GenerateToken() string {
 	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
 	token := make([]byte, 32)
 	for i := range token {
-		token[i] = charset[rand.Intn(len(charset))]
+		token[i] = charset[mathrand.Intn(len(charset))]
 	}
 	return string(token)
 }
 
+// GenerateSecureToken returns a URL-safe random token built from byteLen
+// bytes of crypto/rand output
+func GenerateSecureToken(byteLen int) (string, error) {
+	buf := make([]byte, byteLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the SHA-256 hex digest of a bearer token so it can be
+// stored and looked up without keeping the token itself
+func HashToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
 // GenerateQRHash generates a 10-character QR hash
 func GenerateQRHash(customerID string) string {
 	saltedString := "Jimpitan" + customerID
@@ -44,19 +153,19 @@ func GenerateQRHash(customerID string) string {
 	return hashHex
 }
 
-// GenerateUserID generates a user ID in format USR-XXX
-func GenerateUserID(count int) string {
-	return fmt.Sprintf("USR-%03d", count+1)
+// GenerateUserID formats a users sequence value as USR-XXX
+func GenerateUserID(seq int64) string {
+	return fmt.Sprintf("USR-%03d", seq)
 }
 
-// GenerateCustomerID generates a customer ID in format CUST-XXX
-func GenerateCustomerID(count int) string {
-	return fmt.Sprintf("CUST-%03d", count+1)
+// GenerateCustomerID formats a customers sequence value as CUST-XXX
+func GenerateCustomerID(seq int64) string {
+	return fmt.Sprintf("CUST-%03d", seq)
 }
 
-// GenerateTXID generates a transaction ID
-func GenerateTXID(count int) string {
-	return fmt.Sprintf("%04d", count+1)
+// GenerateTXID formats a transactions sequence value as a transaction ID
+func GenerateTXID(seq int64) string {
+	return fmt.Sprintf("%04d", seq)
 }
 
 // GetCurrentTimestamp returns current timestamp in ISO format
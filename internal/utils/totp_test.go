@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the RFC 4226 / RFC 6238 SHA-1 test key "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 appendix D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	key := []byte("12345678901234567890")
+	for counter, code := range want {
+		if got := hotp(key, int64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, truncated to 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step, ok := VerifyTOTP(rfcSecret, tt.code, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("VerifyTOTP(%s) at %d rejected", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("VerifyTOTP(%s) at %d step = %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestVerifyTOTPSkew(t *testing.T) {
+	at := time.Unix(1111111109, 0) // step 37037036, code 081804
+
+	for _, offset := range []time.Duration{-totpPeriod * time.Second, 0, totpPeriod * time.Second} {
+		if _, ok := VerifyTOTP(rfcSecret, "081804", at.Add(offset)); !ok {
+			t.Errorf("code rejected at offset %s", offset)
+		}
+	}
+	for _, offset := range []time.Duration{-2 * totpPeriod * time.Second, 2 * totpPeriod * time.Second} {
+		if _, ok := VerifyTOTP(rfcSecret, "081804", at.Add(offset)); ok {
+			t.Errorf("code accepted at offset %s", offset)
+		}
+	}
+}
+
+func TestVerifyTOTPRejects(t *testing.T) {
+	at := time.Unix(59, 0)
+	tests := map[string]struct{ secret, code string }{
+		"wrong code":     {rfcSecret, "287083"},
+		"short code":     {rfcSecret, "28708"},
+		"long code":      {rfcSecret, "2870820"},
+		"invalid secret": {"not base32!", "287082"},
+	}
+	for name, tt := range tests {
+		if _, ok := VerifyTOTP(tt.secret, tt.code, at); ok {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	// Surrounding spaces and a lower-case secret are tolerated
+	if _, ok := VerifyTOTP(strings.ToLower(rfcSecret), " 287082 ", at); !ok {
+		t.Error("padded code with lower-case secret rejected")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+
+	now := time.Now()
+	if _, ok := VerifyTOTP(secret, hotp(key, now.Unix()/totpPeriod), now); !ok {
+		t.Error("current code for a generated secret rejected")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("Jimpitan RT", "admin", rfcSecret)
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Jimpitan RT:admin" {
+		t.Errorf("uri = %s", uri)
+	}
+	q := u.Query()
+	if q.Get("secret") != rfcSecret || q.Get("issuer") != "Jimpitan RT" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("query = %v", q)
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	code, err := GenerateReadableCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 11 || code[5] != '-' {
+		t.Fatalf("code %q is not xxxxx-xxxxx", code)
+	}
+	if i := strings.IndexFunc(code[:5]+code[6:], func(r rune) bool {
+		return !strings.ContainsRune("abcdefghjkmnpqrstuvwxyz23456789", r)
+	}); i >= 0 {
+		t.Fatalf("code %q has a character outside the alphabet", code)
+	}
+
+	typed := " " + strings.ToUpper(code[:5]) + " " + code[6:]
+	if NormalizeRecoveryCode(typed) != NormalizeRecoveryCode(code) {
+		t.Errorf("%q and %q normalize differently", typed, code)
+	}
+}
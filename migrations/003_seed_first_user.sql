@@ -1,6 +1,6 @@
 -- Seed: Insert first admin user
 -- Username: admin
--- Password: admin123 (SHA-256 hash)
+-- Password: admin123 (argon2id hash)
 -- Role: admin
 
 INSERT INTO users (
@@ -16,13 +16,15 @@ INSERT INTO users (
   'Administrator',
   'admin',
   'admin',
-  '240be518fabd2724ddb6f04eeb1da5967448d7e831c08c8fa822809f74c720a9',
+  '$argon2id$v=19$m=65536,t=3,p=2$2NeD8Ktvwz37qxuNvtkLMw$KKHdVknIuqba6tH8qFiCiYwCTDS1v3njemGPp/UgL40',
   NOW(),
   NOW()
 ) ON DUPLICATE KEY UPDATE
   updated_at = NOW();
 
 -- Insert petugas user for testing
+-- Username: petugas
+-- Password: petugas123 (argon2id hash)
 INSERT INTO users (
   id,
   name,
@@ -36,7 +38,7 @@ INSERT INTO users (
   'Petugas Default',
   'petugas',
   'petugas',
-  '2dad904f71aa0dcf6ea1addaa084a5865ffe448e4d3f900668e1cc7e7b6153d7',
+  '$argon2id$v=19$m=65536,t=3,p=2$X1UNHEOcoN5SbUDGhgJ1TA$5iZ+DsbxJ6p1ykWiM5sBQB75xbnLJMw4xuGvLQLtAWg',
   NOW(),
   NOW()
 ) ON DUPLICATE KEY UPDATE
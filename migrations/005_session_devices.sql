@@ -0,0 +1,8 @@
+-- Migration: Track device information on server-side sessions
+-- sessions.token now stores the SHA-256 digest of the issued JWT
+
+ALTER TABLE sessions
+  ADD COLUMN device_name VARCHAR(255) NULL AFTER token,
+  ADD COLUMN user_agent VARCHAR(512) NULL AFTER device_name,
+  ADD COLUMN ip_address VARCHAR(45) NULL AFTER user_agent,
+  ADD COLUMN last_seen_at DATETIME NULL AFTER expires_at;
@@ -0,0 +1,5 @@
+-- Migration: Per-user token version for immediate token revocation
+-- Every issued JWT carries the version; bumping it invalidates all of them
+
+ALTER TABLE users
+  ADD COLUMN token_version INT NOT NULL DEFAULT 0 AFTER password_hash;
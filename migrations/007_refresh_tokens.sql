@@ -0,0 +1,14 @@
+-- Migration: Rotating refresh tokens
+-- Each session is one token family; reusing a rotated token revokes the session
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  session_id VARCHAR(255) NOT NULL COMMENT 'Token family',
+  token_hash CHAR(64) NOT NULL UNIQUE COMMENT 'SHA-256 of the refresh token',
+  expires_at DATETIME NOT NULL,
+  used_at DATETIME COMMENT 'Set when rotated; reuse after this revokes the family',
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+  INDEX idx_session_id (session_id),
+  INDEX idx_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,5 @@
+-- Migration: Additional roles for permission-based access control
+-- bendahara = treasurer, ketua_rt = RT chairman, warga = read-only resident
+
+ALTER TABLE users
+  MODIFY COLUMN role ENUM('admin', 'bendahara', 'ketua_rt', 'petugas', 'warga') NOT NULL;
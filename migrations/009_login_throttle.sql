@@ -0,0 +1,27 @@
+-- Migration: Brute-force protection for login
+-- Failed attempts are tracked per username and per IP address
+
+CREATE TABLE IF NOT EXISTS login_throttles (
+  scope ENUM('username', 'ip') NOT NULL,
+  subject VARCHAR(255) NOT NULL COMMENT 'Lower-cased username or IP address',
+  failures INT NOT NULL DEFAULT 0,
+  last_failure_at DATETIME NOT NULL,
+  locked_until DATETIME,
+  PRIMARY KEY (scope, subject),
+  INDEX idx_locked_until (locked_until)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Security events (lockouts, unlocks, ...)
+CREATE TABLE IF NOT EXISTS security_events (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  event_type VARCHAR(50) NOT NULL,
+  user_id VARCHAR(20),
+  username VARCHAR(100),
+  ip_address VARCHAR(45),
+  actor_id VARCHAR(20) COMMENT 'User who triggered the event, if any',
+  detail VARCHAR(512),
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX idx_event_type (event_type),
+  INDEX idx_user_id (user_id),
+  INDEX idx_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,29 @@
+-- Migration: TOTP two-factor authentication
+
+ALTER TABLE users
+  ADD COLUMN totp_secret VARCHAR(64) NULL COMMENT 'Base32 TOTP secret (pending until totp_enabled)' AFTER token_version,
+  ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT false AFTER totp_secret,
+  ADD COLUMN totp_last_step BIGINT NULL COMMENT 'Last accepted TOTP time step, prevents replay' AFTER totp_enabled;
+
+-- One-time recovery codes
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  user_id VARCHAR(20) NOT NULL,
+  code_hash CHAR(64) NOT NULL COMMENT 'SHA-256 of the normalized code',
+  used_at DATETIME,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE KEY uq_user_code (user_id, code_hash)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Pending second-step login challenges
+CREATE TABLE IF NOT EXISTS login_challenges (
+  id CHAR(64) PRIMARY KEY COMMENT 'SHA-256 of the challenge token',
+  user_id VARCHAR(20) NOT NULL,
+  purpose ENUM('totp', 'enroll') NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  expires_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  INDEX idx_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,12 @@
+-- Migration: Admin-issued password reset codes
+-- Codes are stored as SHA-256 hashes and can be redeemed once before they expire
+
+CREATE TABLE IF NOT EXISTS password_reset_codes (
+  user_id VARCHAR(20) PRIMARY KEY COMMENT 'Only the latest code of a user is valid',
+  code_hash CHAR(64) NOT NULL,
+  issued_by VARCHAR(20) NOT NULL,
+  expires_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  INDEX idx_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
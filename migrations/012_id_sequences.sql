@@ -0,0 +1,20 @@
+-- Migration: Sequence table for race-free ID allocation
+-- Replaces COUNT(*)-based IDs, which collided under concurrency and after deletes
+
+CREATE TABLE IF NOT EXISTS id_sequences (
+  name VARCHAR(50) PRIMARY KEY,
+  value BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT 'Last allocated value'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Start each sequence after the highest ID in use, including soft-deleted rows
+INSERT INTO id_sequences (name, value)
+SELECT 'users', COALESCE(MAX(CAST(SUBSTRING(id, 5) AS UNSIGNED)), 0) FROM users WHERE id LIKE 'USR-%'
+ON DUPLICATE KEY UPDATE value = GREATEST(value, VALUES(value));
+
+INSERT INTO id_sequences (name, value)
+SELECT 'customers', COALESCE(MAX(CAST(SUBSTRING(id, 6) AS UNSIGNED)), 0) FROM customers WHERE id LIKE 'CUST-%'
+ON DUPLICATE KEY UPDATE value = GREATEST(value, VALUES(value));
+
+INSERT INTO id_sequences (name, value)
+SELECT 'transactions', COALESCE(MAX(CAST(id AS UNSIGNED)), 0) FROM transactions WHERE id REGEXP '^[0-9]+$'
+ON DUPLICATE KEY UPDATE value = GREATEST(value, VALUES(value));
@@ -0,0 +1,14 @@
+-- Migration: Idempotency keys for transaction submission
+-- A retried submission with the same key returns the stored response instead
+-- of recording the deposit again
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  user_id VARCHAR(20) NOT NULL COMMENT 'Keys are scoped to the submitting user',
+  idem_key VARCHAR(100) NOT NULL COMMENT 'Idempotency-Key header or client_request_id',
+  request_hash CHAR(64) NOT NULL COMMENT 'SHA-256 of the request payload',
+  response JSON NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at DATETIME NOT NULL,
+  PRIMARY KEY (user_id, idem_key),
+  INDEX idx_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
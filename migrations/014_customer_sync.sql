@@ -0,0 +1,4 @@
+-- Migration: Index for customer directory delta sync
+-- Sync pages through customers ordered by (updated_at, id)
+
+ALTER TABLE customers ADD INDEX idx_updated_at_id (updated_at, id);
@@ -0,0 +1,8 @@
+-- Migration: Usernames are unique among active users only
+-- Deleted users keep their username so they can be restored; a new user may
+-- take it over in the meantime, in which case the restore is refused
+
+ALTER TABLE users
+  DROP INDEX username,
+  ADD COLUMN active_username VARCHAR(100) GENERATED ALWAYS AS (IF(deleted_at IS NULL, username, NULL)) STORED,
+  ADD UNIQUE INDEX uq_active_username (active_username);
@@ -0,0 +1,10 @@
+-- Migration: Reversal entries for transactions
+-- Corrections no longer delete ledger rows; they add a row with the negated
+-- nominal that points at the original. An entry can be reversed only once.
+
+ALTER TABLE transactions
+  ADD COLUMN created_by VARCHAR(20) NULL COMMENT 'User who recorded the entry',
+  ADD COLUMN reverses_id VARCHAR(20) NULL COMMENT 'Original entry this reversal cancels',
+  ADD COLUMN reason VARCHAR(255) NULL COMMENT 'Why the original was reversed',
+  ADD UNIQUE INDEX uq_reverses_id (reverses_id),
+  ADD CONSTRAINT fk_transactions_reverses FOREIGN KEY (reverses_id) REFERENCES transactions(id) ON DELETE RESTRICT;
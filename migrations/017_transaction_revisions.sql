@@ -0,0 +1,22 @@
+-- Migration: Editable transactions
+-- Every edit stores the old and new values, the editor and a reason
+
+ALTER TABLE transactions
+  ADD COLUMN notes VARCHAR(255) NULL AFTER petugas;
+
+CREATE TABLE IF NOT EXISTS transaction_revisions (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  transaction_id VARCHAR(20) NOT NULL,
+  old_customer_id VARCHAR(20) NOT NULL,
+  new_customer_id VARCHAR(20) NOT NULL,
+  old_nominal DECIMAL(12, 2) NOT NULL,
+  new_nominal DECIMAL(12, 2) NOT NULL,
+  old_notes VARCHAR(255),
+  new_notes VARCHAR(255),
+  reason VARCHAR(255) NOT NULL,
+  edited_by VARCHAR(20) NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE RESTRICT,
+  FOREIGN KEY (edited_by) REFERENCES users(id) ON DELETE RESTRICT,
+  INDEX idx_transaction_id (transaction_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
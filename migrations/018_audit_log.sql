@@ -0,0 +1,19 @@
+-- Migration: Audit log of every mutating API call
+-- before_json/after_json hold snapshots of the entity around the change
+
+CREATE TABLE IF NOT EXISTS audit_log (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  actor_id VARCHAR(20) COMMENT 'NULL for unauthenticated or system changes',
+  action VARCHAR(30) NOT NULL COMMENT 'create, update, delete, restore, reverse, password_change, login, logout',
+  entity_type VARCHAR(30) NOT NULL COMMENT 'user, customer, transaction',
+  entity_id VARCHAR(64) NOT NULL,
+  before_json JSON,
+  after_json JSON,
+  ip_address VARCHAR(45),
+  user_agent VARCHAR(255),
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX idx_entity (entity_type, entity_id),
+  INDEX idx_actor_id (actor_id),
+  INDEX idx_action (action),
+  INDEX idx_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
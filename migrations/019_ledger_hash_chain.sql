@@ -0,0 +1,26 @@
+-- Migration: Tamper-evident hash chain over the ledger
+-- Every transaction, reversal and revision stores sha256(prev_hash | content).
+-- ledger_chain_head holds the last link and is locked to serialize appends.
+-- Rows written before this migration are chained by `backend-go-server ledger backfill`.
+
+ALTER TABLE transactions
+  ADD COLUMN chain_seq BIGINT NULL,
+  ADD COLUMN prev_hash CHAR(64) NULL,
+  ADD COLUMN entry_hash CHAR(64) NULL,
+  ADD UNIQUE INDEX uq_transactions_chain_seq (chain_seq);
+
+ALTER TABLE transaction_revisions
+  ADD COLUMN chain_seq BIGINT NULL,
+  ADD COLUMN prev_hash CHAR(64) NULL,
+  ADD COLUMN entry_hash CHAR(64) NULL,
+  ADD UNIQUE INDEX uq_revisions_chain_seq (chain_seq);
+
+CREATE TABLE IF NOT EXISTS ledger_chain_head (
+  id TINYINT PRIMARY KEY,
+  seq BIGINT NOT NULL,
+  entry_hash CHAR(64) NOT NULL,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO ledger_chain_head (id, seq, entry_hash)
+VALUES (1, 0, REPEAT('0', 64));
@@ -0,0 +1,31 @@
+-- Migration: Maker-checker approval for sensitive operations
+-- Matching operations are stored as pending requests; a different user with
+-- approvals.decide approves (which executes them) or rejects them.
+
+ALTER TABLE config
+  ADD COLUMN approval_reverse_after_hours INT NOT NULL DEFAULT 24 COMMENT 'Reversing an entry older than this needs approval; 0 disables',
+  ADD COLUMN approval_nominal_threshold DECIMAL(12, 2) NOT NULL DEFAULT 0 COMMENT 'Reversing an entry of at least this nominal needs approval; 0 disables',
+  ADD COLUMN approval_bulk_delete BOOLEAN NOT NULL DEFAULT true,
+  ADD COLUMN approval_role_change BOOLEAN NOT NULL DEFAULT true,
+  ADD COLUMN approval_expiry_hours INT NOT NULL DEFAULT 72;
+
+CREATE TABLE IF NOT EXISTS approval_requests (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  action VARCHAR(40) NOT NULL COMMENT 'transaction.reverse, transaction.bulk_reverse, user.bulk_delete, user.role_change',
+  rule VARCHAR(40) NOT NULL COMMENT 'Config rule that required approval',
+  summary VARCHAR(255) NOT NULL,
+  payload JSON NOT NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending' COMMENT 'pending, approved, rejected, expired, failed',
+  requested_by VARCHAR(20) NOT NULL,
+  decided_by VARCHAR(20),
+  decision_note VARCHAR(255),
+  result JSON,
+  error VARCHAR(255),
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at DATETIME NOT NULL,
+  decided_at DATETIME,
+  FOREIGN KEY (requested_by) REFERENCES users(id) ON DELETE RESTRICT,
+  FOREIGN KEY (decided_by) REFERENCES users(id) ON DELETE RESTRICT,
+  INDEX idx_status (status, expires_at),
+  INDEX idx_requested_by (requested_by, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
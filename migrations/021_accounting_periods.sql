@@ -0,0 +1,16 @@
+-- Migration: Closing of accounting months
+-- A closed period rejects new, edited, reversed or restored transactions
+-- dated in it. Reopening goes through an approval request.
+
+CREATE TABLE IF NOT EXISTS accounting_periods (
+  period CHAR(7) PRIMARY KEY COMMENT 'YYYY-MM',
+  status VARCHAR(20) NOT NULL COMMENT 'closed, reopened',
+  snapshot JSON NOT NULL COMMENT 'Totals per blok and per petugas at the last close',
+  closed_by VARCHAR(20) NOT NULL,
+  closed_at DATETIME NOT NULL,
+  reopened_by VARCHAR(20),
+  reopened_at DATETIME,
+  reopen_reason VARCHAR(255),
+  FOREIGN KEY (closed_by) REFERENCES users(id) ON DELETE RESTRICT,
+  FOREIGN KEY (reopened_by) REFERENCES users(id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,19 @@
+-- Migration: Chained soft deletes and restores of transactions
+-- Every change of transactions.deleted_at is recorded here and chained, so
+-- verify can tell a restore, or a delete from before reversals, apart from
+-- deleted_at being edited directly in the database.
+
+CREATE TABLE IF NOT EXISTS transaction_deletions (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  transaction_id VARCHAR(20) NOT NULL,
+  deleted BOOLEAN NOT NULL COMMENT 'TRUE for a soft delete, FALSE for a restore',
+  recorded_by VARCHAR(20) NULL COMMENT 'NULL for deletes chained by ledger backfill',
+  created_at DATETIME NOT NULL,
+  chain_seq BIGINT NULL,
+  prev_hash CHAR(64) NULL,
+  entry_hash CHAR(64) NULL,
+  UNIQUE INDEX uq_deletions_chain_seq (chain_seq),
+  FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE RESTRICT,
+  FOREIGN KEY (recorded_by) REFERENCES users(id) ON DELETE RESTRICT,
+  INDEX idx_transaction_id (transaction_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
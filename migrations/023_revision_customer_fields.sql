@@ -0,0 +1,16 @@
+-- Migration: Customer blok and nama in transaction revisions
+-- The ledger chain now hashes blok, nama and petugas of every transaction,
+-- since reports and period snapshots group by them. A move to another
+-- customer changes blok and nama, so revisions record both sides.
+-- Existing revisions take the values from the customers table.
+
+ALTER TABLE transaction_revisions
+  ADD COLUMN old_blok VARCHAR(50) NOT NULL DEFAULT '' AFTER new_customer_id,
+  ADD COLUMN new_blok VARCHAR(50) NOT NULL DEFAULT '' AFTER old_blok,
+  ADD COLUMN old_nama VARCHAR(255) NOT NULL DEFAULT '' AFTER new_blok,
+  ADD COLUMN new_nama VARCHAR(255) NOT NULL DEFAULT '' AFTER old_nama;
+
+UPDATE transaction_revisions r
+  JOIN customers o ON o.id = r.old_customer_id
+  JOIN customers n ON n.id = r.new_customer_id
+SET r.old_blok = o.blok, r.old_nama = o.nama, r.new_blok = n.blok, r.new_nama = n.nama;